@@ -28,6 +28,33 @@ type WebAPIConfiguration struct {
 	DB    struct {
 		Filename string `conf:"default:/tmp/wasatxt.db"`
 	}
+	Session struct {
+		TTL time.Duration `conf:"default:720h"`
+	}
+	Messages struct {
+		EditWindow    time.Duration `conf:"default:15m"`
+		UndoWindow    time.Duration `conf:"default:10m"`
+		PurgeInterval time.Duration `conf:"default:1m"`
+		// SchedulerInterval is how often the due scheduled messages are sent
+		SchedulerInterval time.Duration `conf:"default:10s"`
+		// SweepInterval is how often the expired disappearing messages and sessions are deleted
+		SweepInterval time.Duration `conf:"default:1m"`
+		// MaxPins is how many messages can be pinned at once in a conversation
+		MaxPins int `conf:"default:20"`
+		// MaxLiveLocation is the longest time a live location can be shared for
+		MaxLiveLocation time.Duration `conf:"default:8h"`
+	}
+	// OIDC enables the single sign-on login when Issuer is set
+	OIDC struct {
+		Issuer       string
+		ClientID     string
+		ClientSecret string `conf:"mask"`
+		RedirectURL  string
+	}
+	// SCIM enables the user provisioning endpoints when Token is set
+	SCIM struct {
+		Token string `conf:"mask"`
+	}
 }
 
 // loadConfiguration creates a WebAPIConfiguration starting from flags, environment variables and configuration file.
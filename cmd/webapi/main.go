@@ -40,6 +40,8 @@ import (
 
 	"github.com/maisto1/WasaText/service/globaltime"
 
+	"github.com/maisto1/WasaText/service/oidc"
+
 	"github.com/ardanlabs/conf"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/sirupsen/logrus"
@@ -100,6 +102,9 @@ func run() error {
 		logger.WithError(err).Error("error creating AppDatabase")
 		return fmt.Errorf("creating AppDatabase: %w", err)
 	}
+	if !db.SearchAvailable() {
+		logger.Warn("full-text search disabled: SQLite was built without FTS5, build with -tags sqlite_fts5 to enable it")
+	}
 
 	// Start (main) API server
 	logger.Info("initializing API server")
@@ -113,15 +118,43 @@ func run() error {
 	// buffered channel so the goroutine can exit if we don't collect this error.
 	serverErrors := make(chan error, 1)
 
+	// Configure the single sign-on login, if enabled
+	var oidcProvider *oidc.Provider
+	if cfg.OIDC.Issuer != "" {
+		oidcProvider, err = oidc.New(oidc.Config{
+			Issuer:       cfg.OIDC.Issuer,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+		})
+		if err != nil {
+			logger.WithError(err).Error("error configuring OIDC")
+			return fmt.Errorf("configuring OIDC: %w", err)
+		}
+	}
+
 	// Create the API router
 	apirouter, err := api.New(api.Config{
-		Logger:   logger,
-		Database: db,
+		Logger:            logger,
+		Database:          db,
+		SessionTTL:        cfg.Session.TTL,
+		OIDC:              oidcProvider,
+		ScimToken:         cfg.SCIM.Token,
+		EditWindow:        cfg.Messages.EditWindow,
+		UndoWindow:        cfg.Messages.UndoWindow,
+		PurgeInterval:     cfg.Messages.PurgeInterval,
+		SchedulerInterval: cfg.Messages.SchedulerInterval,
+		SweepInterval:     cfg.Messages.SweepInterval,
+		MaxPins:           cfg.Messages.MaxPins,
+		MaxLiveLocation:   cfg.Messages.MaxLiveLocation,
 	})
 	if err != nil {
 		logger.WithError(err).Error("error creating the API server instance")
 		return fmt.Errorf("creating the API server instance: %w", err)
 	}
+
+	// Start the periodic jobs, like the purge of deleted messages. They are stopped by apirouter.Close()
+	apirouter.StartBackgroundTasks()
 	router := apirouter.Handler()
 
 	router, err = registerWebUI(router)
@@ -3,15 +3,22 @@ package api
 import (
 	"errors"
 	"net/http"
-	"strconv"
+	"strings"
+	"time"
 
 	"github.com/maisto1/WasaText/service/api/reqcontext"
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
 
 	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 )
 
+// sessionTouchInterval is how stale the last-used time of a session can get before a request refreshes it, so that
+// authenticated requests do not write to the database every time.
+const sessionTouchInterval = 5 * time.Minute
+
 // httpRouterHandler is the signature for functions that accepts a reqcontext.RequestContext in addition to those
 // required by the httprouter package.
 type httpRouterHandler func(http.ResponseWriter, *http.Request, httprouter.Params, reqcontext.RequestContext)
@@ -36,13 +43,67 @@ func (rt *_router) wrap(fn httpRouterHandler, auth bool) func(http.ResponseWrite
 		})
 
 		if auth {
-			ctx.User_id, err = ExtractId_from_Bearer(r.Header.Get("Authorization"))
+			token, err := ExtractToken_from_Bearer(r.Header.Get("Authorization"))
 			if err != nil {
 				ctx.Logger.WithError(err).Error("ERROR wrap: ")
-				ctx.User_id = 0
 				w.WriteHeader(http.StatusUnauthorized)
 				return
 			}
+
+			if strings.HasPrefix(token, apiKeyPrefix) {
+				key, err := rt.db.GetApiKey(hashToken(token))
+				if err != nil {
+					if err.Error() == constants.ApiKeyNotFound {
+						ctx.Logger.WithError(err).Error("ERROR wrap: ")
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					ctx.Logger.WithError(err).Error("ERROR wrap: can't resolve api key")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				if !hasScope(key.Scopes, requiredScope(r.Method)) {
+					ctx.Logger.Error("ERROR wrap: api key without scope " + requiredScope(r.Method))
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+
+				ctx.User_id = key.Bot_id
+				ctx.IsBot = true
+
+				if key.LastUsedAt == nil || globaltime.Since(time.Unix(*key.LastUsedAt, 0)) > sessionTouchInterval {
+					err = rt.db.TouchApiKey(key.Key_id)
+					if err != nil {
+						ctx.Logger.WithError(err).Warning("wrap: can't update api key last use")
+					}
+				}
+
+				fn(w, r, ps, ctx)
+				return
+			}
+
+			session, err := rt.db.GetSession(hashToken(token))
+			if err != nil {
+				if err.Error() == constants.SessionNotFound || err.Error() == constants.SessionExpired {
+					ctx.Logger.WithError(err).Error("ERROR wrap: ")
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				ctx.Logger.WithError(err).Error("ERROR wrap: can't resolve session")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			ctx.User_id = session.User_id
+			ctx.Session_id = session.Session_id
+
+			if globaltime.Since(time.Unix(session.LastUsedAt, 0)) > sessionTouchInterval {
+				err = rt.db.TouchSession(session.Session_id, r.RemoteAddr)
+				if err != nil {
+					ctx.Logger.WithError(err).Warning("wrap: can't update session last use")
+				}
+			}
 		}
 
 		// Call the next handler in chain (usually, the handler function for the path)
@@ -50,9 +111,21 @@ func (rt *_router) wrap(fn httpRouterHandler, auth bool) func(http.ResponseWrite
 	}
 }
 
-func ExtractId_from_Bearer(token string) (int64, error) {
-	if len(token) < len("Bearer ") || token[:len("Bearer ")] != "Bearer " {
-		return 0, errors.New("invalid Bearer token format")
+// humanOnly wraps handlers that bots must not use, like the ones managing credentials or the profile.
+func (rt *_router) humanOnly(fn httpRouterHandler) httpRouterHandler {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+		if ctx.IsBot {
+			ctx.Logger.Error("ERROR humanOnly: endpoint not available to bots")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fn(w, r, ps, ctx)
+	}
+}
+
+func ExtractToken_from_Bearer(header string) (string, error) {
+	if len(header) <= len("Bearer ") || header[:len("Bearer ")] != "Bearer " {
+		return "", errors.New("invalid Bearer token format")
 	}
-	return strconv.ParseInt(token[len("Bearer "):], 10, 64)
+	return header[len("Bearer "):], nil
 }
@@ -10,6 +10,15 @@ func (rt *_router) Handler() http.Handler {
 	// Login or Register route
 	rt.router.POST("/session", rt.wrap(rt.Login, false))
 
+	// Start a single sign-on login at the identity provider
+	rt.router.GET("/session/oidc", rt.wrap(rt.OidcAuthorize, false))
+
+	// Complete a single sign-on login with the authorization code
+	rt.router.POST("/session/oidc/callback", rt.wrap(rt.OidcCallback, false))
+
+	// Logout, revoking the session used for the request
+	rt.router.DELETE("/session", rt.wrap(rt.humanOnly(rt.Logout), true))
+
 	// Get conversations preview
 	rt.router.GET("/conversations/", rt.wrap(rt.GetPreviewConversations, true))
 
@@ -19,18 +28,90 @@ func (rt *_router) Handler() http.Handler {
 	// Get messages of a specific conversation
 	rt.router.GET("/conversations/:ConversationId", rt.wrap(rt.GetMessages, true))
 
+	// Mark a conversation as read up to a message, or as unread again
+	rt.router.PUT("/conversations/:ConversationId/read", rt.wrap(rt.SetLastRead, true))
+
+	// Set the disappearing messages timer of a conversation
+	rt.router.PUT("/conversations/:ConversationId/timer", rt.wrap(rt.SetMessageTimer, true))
+
+	// Get the pinned messages of a conversation
+	rt.router.GET("/conversations/:ConversationId/pins", rt.wrap(rt.GetPinnedMessages, true))
+
 	// Send a message in a specific conversation
 	rt.router.POST("/conversations/:ConversationId/messages/", rt.wrap(rt.CreateMessage, true))
 
+	// Schedule a message to be sent later in a conversation
+	rt.router.POST("/conversations/:ConversationId/scheduled/", rt.wrap(rt.CreateScheduledMessage, true))
+
+	// Get the pending scheduled messages of the user in a conversation
+	rt.router.GET("/conversations/:ConversationId/scheduled/", rt.wrap(rt.GetScheduledMessages, true))
+
+	// Change a pending scheduled message
+	rt.router.PUT("/conversations/:ConversationId/scheduled/:ScheduledId", rt.wrap(rt.UpdateScheduledMessage, true))
+
+	// Cancel a pending scheduled message
+	rt.router.DELETE("/conversations/:ConversationId/scheduled/:ScheduledId", rt.wrap(rt.DeleteScheduledMessage, true))
+
 	// Delete a message from a conversation
 	rt.router.DELETE("/conversations/:ConversationId/messages/:MessageId", rt.wrap(rt.DeleteMessage, true))
 
+	// Edit the text of a message
+	rt.router.PATCH("/conversations/:ConversationId/messages/:MessageId", rt.wrap(rt.EditMessage, true))
+
+	// Get the revisions of a message
+	rt.router.GET("/conversations/:ConversationId/messages/:MessageId/edits", rt.wrap(rt.GetMessageEdits, true))
+
+	// Restore a message deleted within the undo window
+	rt.router.POST("/conversations/:ConversationId/messages/:MessageId/restore", rt.wrap(rt.RestoreMessage, true))
+
 	// Forward a message to another conversation
 	rt.router.POST("/conversations/:ConversationId/messages/:MessageId", rt.wrap(rt.ForwardMessage, true))
 
 	// Reply to a message
 	rt.router.POST("/conversations/:ConversationId/messages/:MessageId/reply", rt.wrap(rt.ReplyMessage, true))
 
+	// Reply to a message in its thread
+	rt.router.POST("/conversations/:ConversationId/messages/:MessageId/thread", rt.wrap(rt.CreateThreadReply, true))
+
+	// Get the thread of a message with a page of its replies
+	rt.router.GET("/conversations/:ConversationId/messages/:MessageId/thread", rt.wrap(rt.GetThread, true))
+
+	// React to a message, replacing the previous reaction of the user
+	rt.router.PUT("/conversations/:ConversationId/messages/:MessageId/reaction", rt.wrap(rt.SetReaction, true))
+
+	// Remove the reaction of the user to a message
+	rt.router.DELETE("/conversations/:ConversationId/messages/:MessageId/reaction", rt.wrap(rt.DeleteReaction, true))
+
+	// Get who reacted to a message
+	rt.router.GET("/conversations/:ConversationId/messages/:MessageId/reactions", rt.wrap(rt.GetReactions, true))
+
+	// Pin a message at the top of its conversation
+	rt.router.PUT("/conversations/:ConversationId/messages/:MessageId/pin", rt.wrap(rt.PinMessage, true))
+
+	// Unpin a message
+	rt.router.DELETE("/conversations/:ConversationId/messages/:MessageId/pin", rt.wrap(rt.UnpinMessage, true))
+
+	// Vote on a poll, replacing the previous vote of the user
+	rt.router.PUT("/conversations/:ConversationId/messages/:MessageId/vote", rt.wrap(rt.VotePoll, true))
+
+	// Close a poll, freezing its results
+	rt.router.POST("/conversations/:ConversationId/messages/:MessageId/close", rt.wrap(rt.ClosePoll, true))
+
+	// Move a live location shared by the user
+	rt.router.PUT("/conversations/:ConversationId/messages/:MessageId/location", rt.wrap(rt.UpdateLiveLocation, true))
+
+	// Stop sharing a live location
+	rt.router.POST("/conversations/:ConversationId/messages/:MessageId/location/stop", rt.wrap(rt.StopLiveLocation, true))
+
+	// Star a message for the user
+	rt.router.PUT("/conversations/:ConversationId/messages/:MessageId/star", rt.wrap(rt.StarMessage, true))
+
+	// Remove the star of the user from a message
+	rt.router.DELETE("/conversations/:ConversationId/messages/:MessageId/star", rt.wrap(rt.UnstarMessage, true))
+
+	// Get who received and read a message
+	rt.router.GET("/conversations/:ConversationId/messages/:MessageId/receipts", rt.wrap(rt.GetReceipts, true))
+
 	// Get a message's comment
 	rt.router.GET("/conversations/:ConversationId/messages/:MessageId/comments/", rt.wrap(rt.GetComments, true))
 
@@ -56,14 +137,80 @@ func (rt *_router) Handler() http.Handler {
 	rt.router.PUT("/conversations/:ConversationId/photo", rt.wrap(rt.EditPhoto, true))
 
 	// Update profile name
-	rt.router.PUT("/users/profile/username", rt.wrap(rt.EditProfileName, true))
+	rt.router.PUT("/users/profile/username", rt.wrap(rt.humanOnly(rt.EditProfileName), true))
 
 	// Update profile photo
 	rt.router.PUT("/users/profile/photo", rt.wrap(rt.EditProfilePhoto, true))
 
+	// Set or change the profile password
+	rt.router.PUT("/users/profile/password", rt.wrap(rt.humanOnly(rt.EditProfilePassword), true))
+
+	// Start the TOTP enrollment
+	rt.router.POST("/users/profile/totp", rt.wrap(rt.humanOnly(rt.EnrollTotp), true))
+
+	// Confirm the TOTP enrollment with a code
+	rt.router.POST("/users/profile/totp/confirm", rt.wrap(rt.humanOnly(rt.ConfirmTotp), true))
+
+	// Disable TOTP
+	rt.router.DELETE("/users/profile/totp", rt.wrap(rt.humanOnly(rt.DisableTotp), true))
+
+	// Get the deleted messages of the user which can still be restored
+	rt.router.GET("/users/profile/trash", rt.wrap(rt.GetTrash, true))
+
+	// Get the messages and comments mentioning the user or replying to them
+	rt.router.GET("/users/profile/inbox", rt.wrap(rt.GetInbox, true))
+
+	// Mark the inbox of the user as seen up to an item
+	rt.router.PUT("/users/profile/inbox/seen", rt.wrap(rt.MarkInboxSeen, true))
+
+	// Get the messages starred by the user
+	rt.router.GET("/users/profile/starred", rt.wrap(rt.GetStarredMessages, true))
+
+	// Get the active sessions of the user
+	rt.router.GET("/users/profile/sessions", rt.wrap(rt.humanOnly(rt.GetSessions), true))
+
+	// Revoke every session of the user, the current one included
+	rt.router.DELETE("/users/profile/sessions", rt.wrap(rt.humanOnly(rt.RevokeSessions), true))
+
+	// Revoke a session of the user
+	rt.router.DELETE("/users/profile/sessions/:SessionId", rt.wrap(rt.humanOnly(rt.RevokeSession), true))
+
+	// Create a bot owned by the user
+	rt.router.POST("/users/profile/bots/", rt.wrap(rt.humanOnly(rt.CreateBot), true))
+
+	// Get the bots owned by the user
+	rt.router.GET("/users/profile/bots/", rt.wrap(rt.humanOnly(rt.GetBots), true))
+
+	// Create an API key for a bot
+	rt.router.POST("/users/profile/bots/:BotId/keys/", rt.wrap(rt.humanOnly(rt.CreateApiKey), true))
+
+	// Get the API keys of a bot
+	rt.router.GET("/users/profile/bots/:BotId/keys/", rt.wrap(rt.humanOnly(rt.GetApiKeys), true))
+
+	// Revoke an API key of a bot
+	rt.router.DELETE("/users/profile/bots/:BotId/keys/:KeyId", rt.wrap(rt.humanOnly(rt.RevokeApiKey), true))
+
+	// Search the messages and comments of the user's conversations
+	rt.router.GET("/search", rt.wrap(rt.SearchMessages, true))
+
 	// Get users infos
 	rt.router.GET("/users/", rt.wrap(rt.GetUsers, true))
 
+	// List provisioned users (SCIM)
+	rt.router.GET("/scim/v2/Users", rt.wrap(rt.scimAuth(rt.ScimGetUsers), false))
+
+	// Provision a new user (SCIM)
+	rt.router.POST("/scim/v2/Users", rt.wrap(rt.scimAuth(rt.ScimCreateUser), false))
+
+	// Get a provisioned user (SCIM)
+	rt.router.GET("/scim/v2/Users/:UserId", rt.wrap(rt.scimAuth(rt.ScimGetUser), false))
+
+	// Update or (de)activate a provisioned user (SCIM)
+	rt.router.PATCH("/scim/v2/Users/:UserId", rt.wrap(rt.scimAuth(rt.ScimPatchUser), false))
+
+	// Deprovision a user (SCIM)
+	rt.router.DELETE("/scim/v2/Users/:UserId", rt.wrap(rt.scimAuth(rt.ScimDeleteUser), false))
+
 	// Special routes
 	rt.router.GET("/liveness", rt.liveness)
 
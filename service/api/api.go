@@ -9,8 +9,11 @@ Example:
 
 	// Create the API router
 	apirouter, err := api.New(api.Config{
-		Logger:   logger,
-		Database: appdb,
+		Logger:        logger,
+		Database:      appdb,
+		SessionTTL:    cfg.Session.TTL,
+		PurgeInterval: cfg.Messages.PurgeInterval,
+		// ... other settings
 	})
 	if err != nil {
 		logger.WithError(err).Error("error creating the API server instance")
@@ -39,8 +42,11 @@ package api
 import (
 	"errors"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/maisto1/WasaText/service/database"
+	"github.com/maisto1/WasaText/service/oidc"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
@@ -53,6 +59,37 @@ type Config struct {
 
 	// Database is the instance of database.AppDatabase where data are saved
 	Database database.AppDatabase
+
+	// SessionTTL is how long a session token issued by the login stays valid
+	SessionTTL time.Duration
+
+	// OIDC is the identity provider for the single sign-on login. If nil, the single sign-on is disabled
+	OIDC *oidc.Provider
+
+	// ScimToken is the bearer token of the identity management system allowed to provision users via SCIM. If
+	// empty, the SCIM endpoints are disabled
+	ScimToken string
+
+	// EditWindow is how long after sending a message its sender can edit it
+	EditWindow time.Duration
+
+	// UndoWindow is how long a deleted message stays in the trash of its sender, who can restore it
+	UndoWindow time.Duration
+
+	// PurgeInterval is how often the messages deleted for longer than UndoWindow are erased
+	PurgeInterval time.Duration
+
+	// SchedulerInterval is how often the scheduled messages are checked and sent when due
+	SchedulerInterval time.Duration
+
+	// SweepInterval is how often the expired disappearing messages and sessions are deleted
+	SweepInterval time.Duration
+
+	// MaxPins is how many messages can be pinned at once in a conversation
+	MaxPins int
+
+	// MaxLiveLocation is the longest time a live location can be shared for
+	MaxLiveLocation time.Duration
 }
 
 // Router is the package API interface representing an API handler builder
@@ -60,6 +97,9 @@ type Router interface {
 	// Handler returns an HTTP handler for APIs provided in this package
 	Handler() http.Handler
 
+	// StartBackgroundTasks starts the periodic jobs of the package, until Close is called
+	StartBackgroundTasks()
+
 	// Close terminates any resource used in the package
 	Close() error
 }
@@ -73,6 +113,30 @@ func New(cfg Config) (Router, error) {
 	if cfg.Database == nil {
 		return nil, errors.New("database is required")
 	}
+	if cfg.SessionTTL <= 0 {
+		return nil, errors.New("session TTL must be positive")
+	}
+	if cfg.EditWindow < 0 {
+		return nil, errors.New("edit window can't be negative")
+	}
+	if cfg.UndoWindow < 0 {
+		return nil, errors.New("undo window can't be negative")
+	}
+	if cfg.PurgeInterval <= 0 {
+		return nil, errors.New("purge interval must be positive")
+	}
+	if cfg.SchedulerInterval <= 0 {
+		return nil, errors.New("scheduler interval must be positive")
+	}
+	if cfg.SweepInterval <= 0 {
+		return nil, errors.New("sweep interval must be positive")
+	}
+	if cfg.MaxPins <= 0 {
+		return nil, errors.New("max pins must be positive")
+	}
+	if cfg.MaxLiveLocation < minLiveLocation {
+		return nil, errors.New("max live location duration must be at least " + minLiveLocation.String())
+	}
 
 	// Create a new router where we will register HTTP endpoints. The server will pass requests to this router to be
 	// handled.
@@ -81,9 +145,21 @@ func New(cfg Config) (Router, error) {
 	router.RedirectFixedPath = false
 
 	return &_router{
-		router:     router,
-		baseLogger: cfg.Logger,
-		db:         cfg.Database,
+		router:            router,
+		baseLogger:        cfg.Logger,
+		db:                cfg.Database,
+		sessionTTL:        cfg.SessionTTL,
+		oidc:              cfg.OIDC,
+		scimToken:         cfg.ScimToken,
+		editWindow:        cfg.EditWindow,
+		undoWindow:        cfg.UndoWindow,
+		purgeInterval:     cfg.PurgeInterval,
+		schedulerInterval: cfg.SchedulerInterval,
+		sweepInterval:     cfg.SweepInterval,
+		maxPins:           cfg.MaxPins,
+		maxLiveLocation:   cfg.MaxLiveLocation,
+		attempts:          newThrottle(),
+		stop:              make(chan struct{}),
 	}, nil
 }
 
@@ -95,4 +171,32 @@ type _router struct {
 	baseLogger logrus.FieldLogger
 
 	db database.AppDatabase
+
+	sessionTTL time.Duration
+
+	oidc *oidc.Provider
+
+	scimToken string
+
+	editWindow time.Duration
+
+	undoWindow time.Duration
+
+	purgeInterval time.Duration
+
+	schedulerInterval time.Duration
+
+	sweepInterval time.Duration
+
+	maxPins int
+
+	maxLiveLocation time.Duration
+
+	// attempts throttles the failed logins of each username and IP address
+	attempts *throttle
+
+	// stop is closed by Close to terminate the background tasks, tracked by background
+	stop       chan struct{}
+	stopOnce   sync.Once
+	background sync.WaitGroup
 }
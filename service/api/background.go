@@ -0,0 +1,59 @@
+package api
+
+import (
+	"time"
+
+	"github.com/maisto1/WasaText/service/globaltime"
+)
+
+// StartBackgroundTasks starts the periodic jobs of the API. Each one runs in its own goroutine until Close is called.
+func (rt *_router) StartBackgroundTasks() {
+	rt.runPeriodically("purger", rt.purgeInterval, rt.purgeDeletedMessages)
+	rt.runPeriodically("scheduler", rt.schedulerInterval, rt.sendScheduledMessages)
+	rt.runPeriodically("sweeper", rt.sweepInterval, rt.sweepExpired)
+}
+
+// runPeriodically runs job every interval in a new goroutine, logging its errors, until the router is closed
+func (rt *_router) runPeriodically(name string, interval time.Duration, job func() error) {
+	logger := rt.baseLogger.WithField("task", name)
+
+	rt.background.Add(1)
+	go func() {
+		defer rt.background.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-rt.stop:
+				logger.Debug("background task stopped")
+				return
+			case <-ticker.C:
+				err := job()
+				if err != nil {
+					logger.WithError(err).Error("background task failed")
+				}
+			}
+		}
+	}()
+}
+
+// purgeDeletedMessages erases the messages deleted before the undo window
+func (rt *_router) purgeDeletedMessages() error {
+	purged, err := rt.db.PurgeDeletedMessages(globaltime.Now().Add(-rt.undoWindow).Unix())
+	if purged > 0 {
+		rt.baseLogger.Infof("purger: %d deleted messages erased", purged)
+	}
+	return err
+}
+
+// sweepExpired deletes the expired disappearing messages and sessions. A failure of one doesn't stop the other.
+func (rt *_router) sweepExpired() error {
+	messagesErr := rt.sweepExpiredMessages()
+	sessionsErr := rt.sweepExpiredSessions()
+	if messagesErr != nil {
+		return messagesErr
+	}
+	return sessionsErr
+}
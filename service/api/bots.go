@@ -0,0 +1,253 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/maisto1/WasaText/service/api/reqcontext"
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+const (
+	// apiKeyPrefix tells API keys apart from session tokens in the Authorization header
+	apiKeyPrefix = "wtk_"
+
+	scopeRead  = "read"
+	scopeWrite = "write"
+)
+
+// requiredScope returns the scope an API key needs for a request: reading for safe methods, writing otherwise.
+func requiredScope(method string) string {
+	if method == http.MethodGet || method == http.MethodHead {
+		return scopeRead
+	}
+	return scopeWrite
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidScopes(scopes []string) bool {
+	if len(scopes) == 0 {
+		return false
+	}
+	for _, s := range scopes {
+		if s != scopeRead && s != scopeWrite {
+			return false
+		}
+	}
+	return true
+}
+
+func (rt *_router) CreateBot(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Create Bot: "
+
+	var requestBody struct {
+		Username string `json:"username"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&requestBody)
+	if err != nil || len(requestBody.Username) < constants.MinUsernameLength || len(requestBody.Username) > constants.MaxUsernameLength {
+		ctx.Logger.WithError(err).Error(message + constants.ErrDecBody)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	bot, err := rt.db.CreateBot(ctx.User_id, requestBody.Username)
+	if err != nil {
+		if err.Error() == constants.UsernameTaken {
+			ctx.Logger.WithError(err).Error(message + "username already exists")
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		ctx.Logger.WithError(err).Error(message + "can't create the bot")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	err = json.NewEncoder(w).Encode(bot)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.Info(message + "bot created with ID " + strconv.FormatInt(bot.User_id, 10))
+}
+
+func (rt *_router) GetBots(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Get Bots: "
+
+	bots, err := rt.db.GetBots(ctx.User_id)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "error retrieving bots")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(bots)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.Info(message + "bots sended to client")
+}
+
+func (rt *_router) CreateApiKey(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Create Api Key: "
+
+	bot_id_str := ps.ByName("BotId")
+	bot_id, err := strconv.ParseInt(bot_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid bot_id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var requestBody struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(&requestBody)
+	if err != nil || requestBody.Name == "" || !isValidScopes(requestBody.Scopes) {
+		ctx.Logger.WithError(err).Error(message + constants.ErrDecBody)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "can't generate the key")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	token = apiKeyPrefix + token
+
+	key, err := rt.db.CreateApiKey(ctx.User_id, bot_id, requestBody.Name, hashToken(token), requestBody.Scopes)
+	if err != nil {
+		if err.Error() == constants.BotNotFound {
+			ctx.Logger.WithError(err).Error(message + "bot not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		ctx.Logger.WithError(err).Error(message + "can't create the key")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// The key is returned only here: the database keeps just its hash
+	response := struct {
+		Key   models.ApiKey `json:"key"`
+		Token string        `json:"token"`
+	}{
+		Key:   key,
+		Token: token,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.Info(message + "key created for bot " + bot_id_str)
+}
+
+func (rt *_router) GetApiKeys(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Get Api Keys: "
+
+	bot_id_str := ps.ByName("BotId")
+	bot_id, err := strconv.ParseInt(bot_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid bot_id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	keys, err := rt.db.GetApiKeys(ctx.User_id, bot_id)
+	if err != nil {
+		if err.Error() == constants.BotNotFound {
+			ctx.Logger.WithError(err).Error(message + "bot not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		ctx.Logger.WithError(err).Error(message + "error retrieving keys")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(keys)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.Info(message + "keys sended to client")
+}
+
+func (rt *_router) RevokeApiKey(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Revoke Api Key: "
+
+	bot_id_str := ps.ByName("BotId")
+	bot_id, err := strconv.ParseInt(bot_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid bot_id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	key_id_str := ps.ByName("KeyId")
+	key_id, err := strconv.ParseInt(key_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid key_id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = rt.db.RevokeApiKey(ctx.User_id, bot_id, key_id)
+	if err != nil {
+		if err.Error() == constants.BotNotFound || err.Error() == constants.ApiKeyNotFound {
+			ctx.Logger.WithError(err).Error(message + "bot or key not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		ctx.Logger.WithError(err).Error(message + "can't revoke the key")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info(message + "key revoked")
+}
@@ -71,7 +71,8 @@ func (rt *_router) CreateComment(w http.ResponseWriter, r *http.Request, ps http
 	}
 
 	var requestBody struct {
-		Content string `json:"content"`
+		Content         string `json:"content"`
+		ClientMessageId string `json:"clientMessageId"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -84,7 +85,35 @@ func (rt *_router) CreateComment(w http.ResponseWriter, r *http.Request, ps http
 		return
 	}
 
-	comment, err := rt.db.CreateComment(ctx.User_id, conversation_id, message_id, requestBody.Content)
+	client_message_id, ok := parseClientMessageId(requestBody.ClientMessageId)
+	if !ok {
+		ctx.Logger.Error(message + "invalid client message id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	comment, err := rt.db.CreateComment(ctx.User_id, conversation_id, message_id, requestBody.Content, client_message_id)
+	if err != nil && err.Error() == constants.DuplicateClientMessageId {
+		// A retry of a comment already created is answered with the original comment
+		comment, err = rt.db.GetClientComment(ctx.User_id, client_message_id)
+		if err != nil {
+			ctx.Logger.WithError(err).Error(message + "original comment not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(comment)
+		if err != nil {
+			ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+			return
+		}
+
+		ctx.Logger.Info(message + "retry answered with comment " + strconv.FormatInt(comment.Comment_id, 10))
+		return
+	}
 	if err != nil {
 		ctx.Logger.WithError(err).Error(message + "conversation or message not found")
 		w.WriteHeader(http.StatusNotFound)
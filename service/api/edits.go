@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/maisto1/WasaText/service/api/reqcontext"
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+)
+
+func (rt *_router) EditMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Edit Message: "
+
+	conversation_id_str := ps.ByName("ConversationId")
+	conversation_id, err := strconv.ParseInt(conversation_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.InvalidConvId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	message_id_str := ps.ByName("MessageId")
+	message_id, err := strconv.ParseInt(message_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid message_id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var requestBody struct {
+		Content string `json:"content"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(&requestBody)
+	if err != nil || !isValidMessage("text", requestBody.Content, nil) {
+		ctx.Logger.WithError(err).Error(message + constants.ErrDecBody)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// A zero window disables the editing
+	if rt.editWindow == 0 {
+		ctx.Logger.Error(message + "message editing disabled")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	not_before := globaltime.Now().Add(-rt.editWindow).Unix()
+	mess, err := rt.db.EditMessage(ctx.User_id, conversation_id, message_id, requestBody.Content, not_before)
+	if err != nil {
+		switch err.Error() {
+		case constants.NotMessageSender, constants.NotTextMessage, constants.EditWindowExpired:
+			ctx.Logger.WithError(err).Error(message + "message can't be edited")
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			ctx.Logger.WithError(err).Error(message + "conversation or message not found")
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(mess)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "message " + message_id_str + " edited")
+}
+
+func (rt *_router) GetMessageEdits(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Get Message Edits: "
+
+	conversation_id_str := ps.ByName("ConversationId")
+	conversation_id, err := strconv.ParseInt(conversation_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.InvalidConvId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	message_id_str := ps.ByName("MessageId")
+	message_id, err := strconv.ParseInt(message_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid message_id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	edits, err := rt.db.GetMessageEdits(ctx.User_id, conversation_id, message_id)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "conversation or message not found")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(edits)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "revisions sended to client")
+}
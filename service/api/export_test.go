@@ -0,0 +1,9 @@
+package api
+
+// SendScheduledMessages runs the scheduler once on the router
+func SendScheduledMessages(r Router) error {
+	return r.(*_router).sendScheduledMessages()
+}
+
+// PBKDF2SHA256 derives a key as the password hashes do
+var PBKDF2SHA256 = pbkdf2SHA256
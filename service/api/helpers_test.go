@@ -0,0 +1,111 @@
+package api_test
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/maisto1/WasaText/service/api"
+	"github.com/maisto1/WasaText/service/database"
+	"github.com/maisto1/WasaText/service/globaltime"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestRouter creates the API on a new database. The settings missing in cfg get test defaults.
+func newTestRouter(t *testing.T, cfg api.Config) (api.Router, database.AppDatabase) {
+	dbconn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("opening SQLite: %v", err)
+	}
+	t.Cleanup(func() { _ = dbconn.Close() })
+
+	db, err := database.New(dbconn)
+	if err != nil {
+		t.Fatalf("creating the database: %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	cfg.Logger = logger
+	cfg.Database = db
+	if cfg.SessionTTL == 0 {
+		cfg.SessionTTL = time.Hour
+	}
+	if cfg.PurgeInterval == 0 {
+		cfg.PurgeInterval = time.Minute
+	}
+	if cfg.SchedulerInterval == 0 {
+		cfg.SchedulerInterval = time.Minute
+	}
+	if cfg.SweepInterval == 0 {
+		cfg.SweepInterval = time.Minute
+	}
+	if cfg.MaxPins == 0 {
+		cfg.MaxPins = 3
+	}
+	if cfg.MaxLiveLocation == 0 {
+		cfg.MaxLiveLocation = time.Hour
+	}
+
+	router, err := api.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = router.Close() })
+
+	return router, db
+}
+
+// setTime fixes the current time at unix until the end of the test
+func setTime(t *testing.T, unix int64) {
+	globaltime.FixedTime = time.Unix(unix, 0)
+	t.Cleanup(func() { globaltime.FixedTime = time.Time{} })
+}
+
+// request sends body as JSON, authenticated by token if not empty, and decodes the response into response, if not nil,
+// returning the status
+func request(t *testing.T, method string, url string, token string, body interface{}, response interface{}) int {
+	var reader io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(buf)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if response != nil && resp.StatusCode < 300 {
+		err = json.NewDecoder(resp.Body).Decode(response)
+		if err != nil {
+			t.Fatalf("%s %s: decoding the response: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+type session struct {
+	ID    int64  `json:"id"`
+	Token string `json:"token"`
+}
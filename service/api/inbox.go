@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/maisto1/WasaText/service/api/reqcontext"
+	"github.com/maisto1/WasaText/service/constants"
+)
+
+func (rt *_router) GetInbox(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Get Inbox: "
+
+	before, err := parseIdParam(r, "before")
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid before cursor")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	limit, err := parseLimitParam(r)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid limit")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	unseen_only := false
+	if value := r.URL.Query().Get("unseen"); value != "" {
+		unseen_only, err = strconv.ParseBool(value)
+		if err != nil {
+			ctx.Logger.WithError(err).Error(message + "invalid unseen filter")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := rt.db.GetInbox(ctx.User_id, before, limit, unseen_only)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "error retrieving the inbox")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "inbox sended to client")
+}
+
+func (rt *_router) MarkInboxSeen(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Mark Inbox Seen: "
+
+	var requestBody struct {
+		ItemId int64 `json:"itemId"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&requestBody)
+	if err != nil || requestBody.ItemId <= 0 {
+		ctx.Logger.WithError(err).Error(message + constants.ErrDecBody)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = rt.db.MarkInboxSeen(ctx.User_id, requestBody.ItemId)
+	if err != nil {
+		if err.Error() == constants.InboxItemNotFound {
+			ctx.Logger.WithError(err).Error(message + "inbox item not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		ctx.Logger.WithError(err).Error(message + "error updating the inbox")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info(message + "inbox seen up to item " + strconv.FormatInt(requestBody.ItemId, 10))
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/maisto1/WasaText/service/api/reqcontext"
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+const (
+	// minLiveLocation is the shortest time a live location can be shared for
+	minLiveLocation = time.Minute
+
+	// maxLocationAccuracy bounds the uncertainty of a position, in meters: beyond it the position tells little
+	maxLocationAccuracy = 100000
+
+	maxPlaceLabelLength = 100
+)
+
+// isValidLocationMessage accepts a message of type location, or live_location shared for between minLiveLocation and
+// maxLiveLocation, which carries its place in the location rather than in the content
+func isValidLocationMessage(mediaType, content string, media []byte, location *models.LocationDraft, maxLiveLocation time.Duration) bool {
+	if content != "" || len(media) > 0 || location == nil {
+		return false
+	}
+
+	if !isValidPosition(location.Latitude, location.Longitude, location.Accuracy) {
+		return false
+	}
+
+	label := location.Label
+	if label != "" && (strings.TrimSpace(label) == "" || !utf8.ValidString(label) || utf8.RuneCountInString(label) > maxPlaceLabelLength) {
+		return false
+	}
+
+	switch mediaType {
+	case "location":
+		return location.Duration == 0
+	case "live_location":
+		return location.Duration >= int64(minLiveLocation/time.Second) && location.Duration <= int64(maxLiveLocation/time.Second)
+	default:
+		return false
+	}
+}
+
+// isValidPosition checks that latitude and longitude are given in degrees, and that the accuracy, if known, is a
+// radius in meters
+func isValidPosition(latitude, longitude, accuracy *float64) bool {
+	if latitude == nil || longitude == nil {
+		return false
+	}
+	if *latitude < -90 || *latitude > 90 || *longitude < -180 || *longitude > 180 {
+		return false
+	}
+
+	return accuracy == nil || (*accuracy >= 0 && *accuracy <= maxLocationAccuracy)
+}
+
+func (rt *_router) UpdateLiveLocation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Update Live Location: "
+
+	conversation_id_str := ps.ByName("ConversationId")
+	conversation_id, err := strconv.ParseInt(conversation_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.InvalidConvId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	message_id_str := ps.ByName("MessageId")
+	message_id, err := strconv.ParseInt(message_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid message_id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var requestBody struct {
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+		Accuracy  *float64 `json:"accuracy"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(&requestBody)
+	if err != nil || !isValidPosition(requestBody.Latitude, requestBody.Longitude, requestBody.Accuracy) {
+		ctx.Logger.WithError(err).Error(message + constants.ErrDecBody)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	position := models.Position{
+		Latitude:  *requestBody.Latitude,
+		Longitude: *requestBody.Longitude,
+		Accuracy:  requestBody.Accuracy,
+	}
+
+	mess, err := rt.db.UpdateLiveLocation(ctx.User_id, conversation_id, message_id, position)
+	if err != nil {
+		rt.liveLocationError(w, ctx, message, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(mess)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "live location " + message_id_str + " moved")
+}
+
+func (rt *_router) StopLiveLocation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Stop Live Location: "
+
+	conversation_id_str := ps.ByName("ConversationId")
+	conversation_id, err := strconv.ParseInt(conversation_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.InvalidConvId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	message_id_str := ps.ByName("MessageId")
+	message_id, err := strconv.ParseInt(message_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid message_id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	mess, err := rt.db.StopLiveLocation(ctx.User_id, conversation_id, message_id)
+	if err != nil {
+		rt.liveLocationError(w, ctx, message, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(mess)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "live location " + message_id_str + " stopped")
+}
+
+// liveLocationError answers with the status matching an error of UpdateLiveLocation or StopLiveLocation
+func (rt *_router) liveLocationError(w http.ResponseWriter, ctx reqcontext.RequestContext, message string, err error) {
+	switch err.Error() {
+	case constants.NotMessageSender:
+		ctx.Logger.WithError(err).Error(message + "only the sender can share the live location")
+		w.WriteHeader(http.StatusForbidden)
+	case constants.LiveLocationEnded:
+		ctx.Logger.WithError(err).Error(message + "live location sharing ended")
+		w.WriteHeader(http.StatusConflict)
+	default:
+		ctx.Logger.WithError(err).Error(message + "conversation or live location not found")
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
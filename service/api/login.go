@@ -8,13 +8,43 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/maisto1/WasaText/service/api/reqcontext"
 	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
 )
 
+// loginResponse is returned by every kind of login
+type loginResponse struct {
+	ID        int64  `json:"id"`
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// createSession issues a new session token for an authenticated user.
+func (rt *_router) createSession(r *http.Request, user_id int64) (loginResponse, error) {
+	token, err := newToken()
+	if err != nil {
+		return loginResponse{}, err
+	}
+
+	session, err := rt.db.CreateSession(user_id, hashToken(token), globaltime.Now().Add(rt.sessionTTL).Unix(), r.UserAgent(), r.RemoteAddr)
+	if err != nil {
+		return loginResponse{}, err
+	}
+
+	return loginResponse{
+		ID:        user_id,
+		Token:     token,
+		ExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
 func (rt *_router) Login(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	message := "Login: "
 
 	var requestBody struct {
-		Username string `json:"username"`
+		Username     string `json:"username"`
+		Password     string `json:"password"`
+		TotpCode     string `json:"totpCode"`
+		RecoveryCode string `json:"recoveryCode"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -27,22 +57,88 @@ func (rt *_router) Login(w http.ResponseWriter, r *http.Request, ps httprouter.P
 		return
 	}
 
-	if len(requestBody.Username) < 3 || len(requestBody.Username) > 17 {
+	if len(requestBody.Username) < constants.MinUsernameLength || len(requestBody.Username) > constants.MaxUsernameLength {
 		ctx.Logger.WithError(err).Error(message + "username doesn't respect pattern")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	// Guessing the password is throttled both per user and per client, so that neither a single account nor many
+	// accounts can be tried at length
+	attempts := []string{"username:" + requestBody.Username, "ip:" + remoteIP(r)}
+	if wait := rt.attempts.wait(attempts...); wait > 0 {
+		ctx.Logger.Error(message + "too many failed logins for user " + requestBody.Username)
+		tooManyAttempts(w, wait)
+		return
+	}
+
 	userId, err := rt.db.Login(requestBody.Username)
 	if err != nil {
+		if err.Error() == constants.BotAccount {
+			ctx.Logger.WithError(err).Error(message + "login attempted as bot " + requestBody.Username)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if err.Error() == constants.UserDeactivated {
+			ctx.Logger.WithError(err).Error(message + "login attempted as deactivated user " + requestBody.Username)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if err.Error() == constants.ExternalAccount {
+			ctx.Logger.WithError(err).Error(message + "login without password attempted as external user " + requestBody.Username)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
 		rt.baseLogger.WithError(err).Error(message + "error checking if user exists")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	message = message + "Authenticated user " + requestBody.Username + " with ID " + strconv.FormatInt(userId, 10) + "\n"
+	password_hash, err := rt.db.GetPasswordHash(userId)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "error retrieving user credentials")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-	response := map[string]int64{"id": userId}
+	// Accounts without a password are still open to anyone knowing the username
+	if password_hash != "" && !checkPassword(password_hash, requestBody.Password) {
+		rt.attempts.fail(attempts...)
+		ctx.Logger.Error(message + "wrong password for user " + requestBody.Username)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	ok, err := rt.checkSecondFactor(userId, requestBody.TotpCode, requestBody.RecoveryCode)
+	if err != nil && err.Error() == constants.TooManyFailedAttempts {
+		ctx.Logger.WithError(err).Error(message + "too many wrong TOTP codes for user " + requestBody.Username)
+		tooManyAttempts(w, rt.attempts.wait(secondFactorAttempt(userId)))
+		return
+	}
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "error checking the second factor")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		ctx.Logger.Error(message + "missing or wrong TOTP code for user " + requestBody.Username)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]bool{"totpRequired": true})
+		return
+	}
+
+	// The client isn't cleared, so that logging into an own account doesn't allow guessing the passwords of others
+	rt.attempts.reset(attempts[0])
+
+	response, err := rt.createSession(r, userId)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "can't create the session")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	message = message + "Authenticated user " + requestBody.Username + " with ID " + strconv.FormatInt(userId, 10) + "\n"
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -56,3 +152,17 @@ func (rt *_router) Login(w http.ResponseWriter, r *http.Request, ps httprouter.P
 
 	ctx.Logger.Info(message)
 }
+
+func (rt *_router) Logout(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Logout: "
+
+	err := rt.db.DeleteSession(ctx.Session_id)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "can't revoke the session")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info(message + "session revoked")
+}
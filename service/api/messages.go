@@ -2,15 +2,22 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
+	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/maisto1/WasaText/service/api/reqcontext"
 	"github.com/maisto1/WasaText/service/constants"
 	"github.com/maisto1/WasaText/service/models"
 )
 
+const (
+	defaultMessagesPageSize = 50
+	maxMessagesPageSize     = 100
+)
+
 func (rt *_router) GetMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	message := "Get Messages: "
 	var messages []models.Message
@@ -23,6 +30,17 @@ func (rt *_router) GetMessages(w http.ResponseWriter, r *http.Request, ps httpro
 		return
 	}
 
+	// Without cursor parameters the whole history is returned, as expected by older clients
+	query := r.URL.Query()
+	if query.Has("around") {
+		rt.getMessagesAround(w, r, conversation_id, ctx)
+		return
+	}
+	if query.Has("before") || query.Has("after") || query.Has("limit") {
+		rt.getMessagesPage(w, r, conversation_id, ctx)
+		return
+	}
+
 	messages, err = rt.db.GetMessages(ctx.User_id, conversation_id)
 	if err != nil {
 		ctx.Logger.WithError(err).Error(message + "conversation not found")
@@ -43,6 +61,133 @@ func (rt *_router) GetMessages(w http.ResponseWriter, r *http.Request, ps httpro
 	ctx.Logger.Info(message + "messages sended to client")
 }
 
+func (rt *_router) getMessagesAround(w http.ResponseWriter, r *http.Request, conversation_id int64, ctx reqcontext.RequestContext) {
+	message := "Get Messages: "
+
+	around_id, err := parseIdParam(r, "around")
+	if err != nil || around_id == 0 {
+		ctx.Logger.WithError(err).Error(message + "invalid around message id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if r.URL.Query().Has("before") || r.URL.Query().Has("after") {
+		ctx.Logger.Error(message + "around can't be combined with before or after")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	limit, err := parseLimitParam(r)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid limit")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	page, err := rt.db.GetMessagesAround(ctx.User_id, conversation_id, around_id, limit)
+	if err != nil {
+		if err.Error() == constants.MessageNotFound {
+			ctx.Logger.WithError(err).Error(message + "message not in the conversation")
+		} else {
+			ctx.Logger.WithError(err).Error(message + "conversation not found")
+		}
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "messages around " + strconv.FormatInt(around_id, 10) + " sended to client")
+}
+
+// parseIdParam returns the positive id in the query parameter name, or 0 if it is missing
+func parseIdParam(r *http.Request, name string) (int64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if id <= 0 {
+		return 0, errors.New(name + " must be positive")
+	}
+
+	return id, nil
+}
+
+// parseLimitParam returns the page size in the limit query parameter, capped to maxMessagesPageSize
+func parseLimitParam(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultMessagesPageSize, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if limit <= 0 {
+		return 0, errors.New("limit must be positive")
+	}
+	if limit > maxMessagesPageSize {
+		limit = maxMessagesPageSize
+	}
+
+	return limit, nil
+}
+
+func (rt *_router) getMessagesPage(w http.ResponseWriter, r *http.Request, conversation_id int64, ctx reqcontext.RequestContext) {
+	message := "Get Messages: "
+
+	before, err := parseIdParam(r, "before")
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid before cursor")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	after, err := parseIdParam(r, "after")
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid after cursor")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	limit, err := parseLimitParam(r)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid limit")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	page, err := rt.db.GetMessagesPage(ctx.User_id, conversation_id, before, after, limit)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "conversation not found")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "messages page sended to client")
+}
+
 func isValidMessage(mediaType, content string, media []byte) bool {
 	switch mediaType {
 	case "text":
@@ -54,6 +199,42 @@ func isValidMessage(mediaType, content string, media []byte) bool {
 	}
 }
 
+// parseClientMessageId validates the optional client id of a new message or comment, which must be a UUID, and returns
+// it in canonical form
+func parseClientMessageId(client_message_id string) (string, bool) {
+	if client_message_id == "" {
+		return "", true
+	}
+
+	id, err := uuid.FromString(client_message_id)
+	if err != nil {
+		return "", false
+	}
+
+	return id.String(), true
+}
+
+// replayClientMessage answers a retry of a message already created with the original message
+func (rt *_router) replayClientMessage(w http.ResponseWriter, ctx reqcontext.RequestContext, message string, client_message_id string) {
+	mess, err := rt.db.GetClientMessage(ctx.User_id, client_message_id)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "original message not found")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(mess)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "retry answered with message " + strconv.FormatInt(mess.Message_id, 10))
+}
+
 func (rt *_router) CreateMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	message := "Create Message: "
 
@@ -66,22 +247,47 @@ func (rt *_router) CreateMessage(w http.ResponseWriter, r *http.Request, ps http
 	}
 
 	var requestBody struct {
-		Type    string `json:"type"`
-		Content string `json:"content"`
-		Media   []byte `json:"media"`
+		Type            string                `json:"type"`
+		Content         string                `json:"content"`
+		Media           []byte                `json:"media"`
+		Poll            *models.PollDraft     `json:"poll"`
+		Location        *models.LocationDraft `json:"location"`
+		ClientMessageId string                `json:"clientMessageId"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
 	decoder.DisallowUnknownFields()
 
+	// Polls and locations come with their question and options, or their place, instead of a content
 	err = decoder.Decode(&requestBody)
-	if err != nil || !(isValidMessage(requestBody.Type, requestBody.Content, requestBody.Media)) {
+	if err != nil || !(isValidMessage(requestBody.Type, requestBody.Content, requestBody.Media) && requestBody.Poll == nil && requestBody.Location == nil ||
+		isValidPollMessage(requestBody.Type, requestBody.Content, requestBody.Media, requestBody.Poll) && requestBody.Location == nil ||
+		isValidLocationMessage(requestBody.Type, requestBody.Content, requestBody.Media, requestBody.Location, rt.maxLiveLocation) && requestBody.Poll == nil) {
 		ctx.Logger.WithError(err).Error(message + constants.ErrDecBody)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	mess, err := rt.db.CreateMessage(ctx.User_id, conversation_id, 0, requestBody.Type, requestBody.Content, requestBody.Media, false)
+	client_message_id, ok := parseClientMessageId(requestBody.ClientMessageId)
+	if !ok {
+		ctx.Logger.Error(message + "invalid client message id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var mess models.Message
+	switch {
+	case requestBody.Poll != nil:
+		mess, err = rt.db.CreatePoll(ctx.User_id, conversation_id, *requestBody.Poll, client_message_id)
+	case requestBody.Location != nil:
+		mess, err = rt.db.CreateLocation(ctx.User_id, conversation_id, requestBody.Type, *requestBody.Location, client_message_id)
+	default:
+		mess, err = rt.db.CreateMessage(ctx.User_id, conversation_id, 0, requestBody.Type, requestBody.Content, requestBody.Media, false, client_message_id)
+	}
+	if err != nil && err.Error() == constants.DuplicateClientMessageId {
+		rt.replayClientMessage(w, ctx, message, client_message_id)
+		return
+	}
 	if err != nil {
 		ctx.Logger.WithError(err).Error(message + "conversation not found")
 		w.WriteHeader(http.StatusNotFound)
@@ -120,7 +326,17 @@ func (rt *_router) DeleteMessage(w http.ResponseWriter, r *http.Request, ps http
 		return
 	}
 
-	err = rt.db.DeleteMessage(ctx.User_id, conversation_id, message_id)
+	// "me" hides the message only for the user, "everyone" (the default) leaves a tombstone in its place
+	switch r.URL.Query().Get("for") {
+	case "me":
+		err = rt.db.HideMessage(ctx.User_id, conversation_id, message_id)
+	case "", "everyone":
+		err = rt.db.DeleteMessage(ctx.User_id, conversation_id, message_id)
+	default:
+		ctx.Logger.Error(message + "invalid deletion mode")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		ctx.Logger.WithError(err).Error(message + "user/conversation/message not found")
 		w.WriteHeader(http.StatusNotFound)
@@ -151,7 +367,8 @@ func (rt *_router) ForwardMessage(w http.ResponseWriter, r *http.Request, ps htt
 	}
 
 	var requestBody struct {
-		TargetConversationId int64 `json:"conversationId"`
+		TargetConversationId int64  `json:"conversationId"`
+		ClientMessageId      string `json:"clientMessageId"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -164,7 +381,18 @@ func (rt *_router) ForwardMessage(w http.ResponseWriter, r *http.Request, ps htt
 		return
 	}
 
-	mess, err := rt.db.ForwardMessage(ctx.User_id, conversation_id, requestBody.TargetConversationId, message_id)
+	client_message_id, ok := parseClientMessageId(requestBody.ClientMessageId)
+	if !ok {
+		ctx.Logger.Error(message + "invalid client message id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	mess, err := rt.db.ForwardMessage(ctx.User_id, conversation_id, requestBody.TargetConversationId, message_id, client_message_id)
+	if err != nil && err.Error() == constants.DuplicateClientMessageId {
+		rt.replayClientMessage(w, ctx, message, client_message_id)
+		return
+	}
 	if err != nil {
 		ctx.Logger.WithError(err).Error(message + "user/conversation/message not found")
 		w.WriteHeader(http.StatusNotFound)
@@ -204,9 +432,10 @@ func (rt *_router) ReplyMessage(w http.ResponseWriter, r *http.Request, ps httpr
 	}
 
 	var requestBody struct {
-		Type    string `json:"type"`
-		Content string `json:"content"`
-		Media   []byte `json:"media"`
+		Type            string `json:"type"`
+		Content         string `json:"content"`
+		Media           []byte `json:"media"`
+		ClientMessageId string `json:"clientMessageId"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -219,6 +448,13 @@ func (rt *_router) ReplyMessage(w http.ResponseWriter, r *http.Request, ps httpr
 		return
 	}
 
+	client_message_id, ok := parseClientMessageId(requestBody.ClientMessageId)
+	if !ok {
+		ctx.Logger.Error(message + "invalid client message id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	replyMessage, err := rt.db.ReplyToMessage(
 		ctx.User_id,
 		conversation_id,
@@ -226,7 +462,12 @@ func (rt *_router) ReplyMessage(w http.ResponseWriter, r *http.Request, ps httpr
 		requestBody.Type,
 		requestBody.Content,
 		requestBody.Media,
+		client_message_id,
 	)
+	if err != nil && err.Error() == constants.DuplicateClientMessageId {
+		rt.replayClientMessage(w, ctx, message, client_message_id)
+		return
+	}
 	if err != nil {
 		ctx.Logger.WithError(err).Error(message + "failed to create reply message")
 		w.WriteHeader(http.StatusNotFound)
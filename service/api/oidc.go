@@ -0,0 +1,168 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/maisto1/WasaText/service/api/reqcontext"
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/database"
+	"github.com/maisto1/WasaText/service/globaltime"
+	"github.com/maisto1/WasaText/service/oidc"
+)
+
+// oidcLoginTimeout is how long the user has to complete the login at the identity provider
+const oidcLoginTimeout = 10 * time.Minute
+
+// oidcUsername maps the preferred_username claim onto a valid WasaText username.
+func oidcUsername(claims oidc.Claims) string {
+	username := strings.TrimSpace(claims.PreferredUsername)
+	if i := strings.Index(username, "@"); i > 0 {
+		username = username[:i]
+	}
+	username = database.TruncateUsername(username, constants.MaxUsernameLength)
+	if len(username) < constants.MinUsernameLength {
+		username = "user"
+	}
+	return username
+}
+
+func (rt *_router) OidcAuthorize(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "OIDC Authorize: "
+
+	if rt.oidc == nil {
+		ctx.Logger.Error(message + "single sign-on not configured")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	state, err := oidc.NewState()
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "can't generate the state")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	nonce, err := oidc.NewState()
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "can't generate the nonce")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "can't generate the PKCE verifier")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	authorizationUrl, err := rt.oidc.AuthCodeURL(r.Context(), state, nonce, challenge)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "identity provider not available")
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	err = rt.db.CreateOidcState(state, verifier, nonce, globaltime.Now().Add(oidcLoginTimeout).Unix())
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "can't store the login state")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		AuthorizationUrl string `json:"authorizationUrl"`
+	}{
+		AuthorizationUrl: authorizationUrl,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.Info(message + "login started")
+}
+
+func (rt *_router) OidcCallback(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "OIDC Callback: "
+
+	if rt.oidc == nil {
+		ctx.Logger.Error(message + "single sign-on not configured")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var requestBody struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&requestBody)
+	if err != nil || requestBody.Code == "" || requestBody.State == "" {
+		ctx.Logger.WithError(err).Error(message + constants.ErrDecBody)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	verifier, nonce, err := rt.db.ConsumeOidcState(requestBody.State)
+	if err != nil {
+		if err.Error() == constants.OidcStateNotFound {
+			ctx.Logger.WithError(err).Error(message + "unknown state")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		ctx.Logger.WithError(err).Error(message + "can't retrieve the login state")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	claims, err := rt.oidc.Exchange(r.Context(), requestBody.Code, verifier, nonce)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "code exchange failed")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userId, err := rt.db.LoginIdentity(rt.oidc.Issuer(), claims.Subject, oidcUsername(claims))
+	if err != nil {
+		if err.Error() == constants.UserDeactivated {
+			ctx.Logger.WithError(err).Error(message + "login attempted as deactivated user")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		ctx.Logger.WithError(err).Error(message + "can't map the identity to a user")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response, err := rt.createSession(r, userId)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "can't create the session")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.Info(message + "authenticated subject " + claims.Subject + " as user " + strconv.FormatInt(userId, 10))
+}
@@ -0,0 +1,140 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/maisto1/WasaText/service/api"
+	"github.com/maisto1/WasaText/service/oidc"
+	"github.com/maisto1/WasaText/service/oidc/oidctest"
+)
+
+// newTestServer starts the API with a new database and the single sign-on through a mock identity provider
+func newTestServer(t *testing.T) (*httptest.Server, *oidctest.Server) {
+	idp, err := oidctest.NewServer("wasatext", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(idp.Close)
+
+	provider, err := oidc.New(oidc.Config{
+		Issuer:       idp.URL,
+		ClientID:     "wasatext",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/#/login/callback",
+		HTTPClient:   idp.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router, _ := newTestRouter(t, api.Config{OIDC: provider, ScimToken: "scim-token"})
+
+	server := httptest.NewServer(router.Handler())
+	t.Cleanup(server.Close)
+
+	return server, idp
+}
+
+// oidcLogin logs in through the single sign-on as the user currently set in the identity provider
+func oidcLogin(t *testing.T, server *httptest.Server, idp *oidctest.Server) (int, session) {
+	var authorization struct {
+		AuthorizationUrl string `json:"authorizationUrl"`
+	}
+	status := request(t, http.MethodGet, server.URL+"/session/oidc", "", nil, &authorization)
+	if status != http.StatusOK {
+		t.Fatalf("GET /session/oidc: status %d", status)
+	}
+
+	code, state, err := idp.Authorize(authorization.AuthorizationUrl)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+
+	var s session
+	status = request(t, http.MethodPost, server.URL+"/session/oidc/callback", "", map[string]string{"code": code, "state": state}, &s)
+	return status, s
+}
+
+func TestOidcCallback(t *testing.T) {
+	server, idp := newTestServer(t)
+	idp.Subject = "1234"
+	idp.PreferredUsername = "maria@example.com"
+
+	status, first := oidcLogin(t, server, idp)
+	if status != http.StatusCreated || first.Token == "" {
+		t.Fatalf("first login: status %d", status)
+	}
+
+	// The same subject is the same user
+	status, second := oidcLogin(t, server, idp)
+	if status != http.StatusCreated || second.ID != first.ID {
+		t.Fatalf("second login: status %d, user %d, want user %d", status, second.ID, first.ID)
+	}
+
+	// Another subject with the same username gets another user
+	idp.Subject = "5678"
+	status, other := oidcLogin(t, server, idp)
+	if status != http.StatusCreated || other.ID == first.ID {
+		t.Fatalf("login of another subject: status %d, user %d", status, other.ID)
+	}
+
+	// The user can't be taken over with the username only
+	status = request(t, http.MethodPost, server.URL+"/session", "", map[string]string{"username": "maria"}, nil)
+	if status != http.StatusForbidden {
+		t.Errorf("username only login of a single sign-on user: status %d, want %d", status, http.StatusForbidden)
+	}
+}
+
+func TestOidcCallbackRefusesReplays(t *testing.T) {
+	server, idp := newTestServer(t)
+
+	var authorization struct {
+		AuthorizationUrl string `json:"authorizationUrl"`
+	}
+	request(t, http.MethodGet, server.URL+"/session/oidc", "", nil, &authorization)
+	code, state, err := idp.Authorize(authorization.AuthorizationUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := request(t, http.MethodPost, server.URL+"/session/oidc/callback", "", map[string]string{"code": code, "state": "forged"}, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("callback with an unknown state: status %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	status = request(t, http.MethodPost, server.URL+"/session/oidc/callback", "", map[string]string{"code": code, "state": state}, nil)
+	if status != http.StatusCreated {
+		t.Fatalf("callback: status %d", status)
+	}
+
+	status = request(t, http.MethodPost, server.URL+"/session/oidc/callback", "", map[string]string{"code": code, "state": state}, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("callback replayed: status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestOidcCallbackSignsInProvisionedUser(t *testing.T) {
+	server, idp := newTestServer(t)
+
+	var account struct {
+		Id string `json:"id"`
+	}
+	status := request(t, http.MethodPost, server.URL+"/scim/v2/Users", "scim-token",
+		map[string]interface{}{"userName": "alice", "externalId": "00u1a2b3c4"}, &account)
+	if status != http.StatusCreated {
+		t.Fatalf("SCIM provisioning: status %d", status)
+	}
+
+	idp.Subject = "00u1a2b3c4"
+	idp.PreferredUsername = "alice@example.com"
+	status, s := oidcLogin(t, server, idp)
+	if status != http.StatusCreated {
+		t.Fatalf("login: status %d", status)
+	}
+	if strconv.FormatInt(s.ID, 10) != account.Id {
+		t.Errorf("provisioned user signed in as user %d, want %s", s.ID, account.Id)
+	}
+}
@@ -0,0 +1,78 @@
+package api_test
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/maisto1/WasaText/service/api"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// The first two vectors are from RFC 7914, section 11
+	vectors := []struct {
+		password   string
+		salt       string
+		iterations int
+		key        string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+		{"password", "salt", 4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, "348c89dbcbd32b2f32d814b8116e84cf2b17347ebc1800181c4e2a1fb8dd53e1c635518c7dac47e9"},
+		{"pass\x00word", "sa\x00lt", 4096, "89b69d0516f829893c696226650a8687"},
+	}
+
+	for _, vector := range vectors {
+		want, err := hex.DecodeString(vector.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := api.PBKDF2SHA256([]byte(vector.password), []byte(vector.salt), vector.iterations, len(want))
+		if hex.EncodeToString(key) != vector.key {
+			t.Errorf("PBKDF2(%q, %q, %d) = %x, want %s", vector.password, vector.salt, vector.iterations, key, vector.key)
+		}
+	}
+}
+
+func TestLoginThrottlesWrongPasswords(t *testing.T) {
+	router, db := newTestRouter(t, api.Config{})
+	server := httptest.NewServer(router.Handler())
+	t.Cleanup(server.Close)
+	setTime(t, 1700000000)
+
+	alice, err := db.Login("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A single iteration keeps the test fast, the stored hash carries it
+	salt := []byte("0123456789abcdef")
+	key := api.PBKDF2SHA256([]byte("correct horse"), salt, 1, 32)
+	err = db.SetPassword(alice, "pbkdf2-sha256$1$"+base64.RawStdEncoding.EncodeToString(salt)+"$"+base64.RawStdEncoding.EncodeToString(key), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login := func(password string) int {
+		return request(t, http.MethodPost, server.URL+"/session", "", map[string]string{"username": "alice", "password": password}, nil)
+	}
+
+	for i := 0; i < 5; i++ {
+		if status := login("wrong"); status != http.StatusUnauthorized {
+			t.Fatalf("wrong password %d: status %d, want %d", i+1, status, http.StatusUnauthorized)
+		}
+	}
+
+	// Even the right password is refused until the delay passes
+	if status := login("correct horse"); status != http.StatusTooManyRequests {
+		t.Errorf("login after too many wrong passwords: status %d, want %d", status, http.StatusTooManyRequests)
+	}
+
+	setTime(t, 1700000061)
+	if status := login("correct horse"); status != http.StatusCreated {
+		t.Errorf("login after the delay: status %d, want %d", status, http.StatusCreated)
+	}
+}
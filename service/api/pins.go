@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/maisto1/WasaText/service/api/reqcontext"
+	"github.com/maisto1/WasaText/service/constants"
+)
+
+func (rt *_router) PinMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Pin Message: "
+
+	conversation_id_str := ps.ByName("ConversationId")
+	conversation_id, err := strconv.ParseInt(conversation_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.InvalidConvId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	message_id_str := ps.ByName("MessageId")
+	message_id, err := strconv.ParseInt(message_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid message_id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	notice, err := rt.db.PinMessage(ctx.User_id, conversation_id, message_id, rt.maxPins)
+	if err != nil {
+		switch err.Error() {
+		case constants.NotGroupAdmin:
+			ctx.Logger.WithError(err).Error(message + "user is not a group admin")
+			w.WriteHeader(http.StatusForbidden)
+		case constants.MessageAlreadyPinned:
+			ctx.Logger.WithError(err).Error(message + "message already pinned")
+			w.WriteHeader(http.StatusConflict)
+		case constants.TooManyPins:
+			ctx.Logger.WithError(err).Error(message + "too many pinned messages, at most " + strconv.Itoa(rt.maxPins))
+			w.WriteHeader(http.StatusConflict)
+		default:
+			ctx.Logger.WithError(err).Error(message + "conversation or message not found")
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(notice)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "message " + message_id_str + " pinned")
+}
+
+func (rt *_router) UnpinMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Unpin Message: "
+
+	conversation_id_str := ps.ByName("ConversationId")
+	conversation_id, err := strconv.ParseInt(conversation_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.InvalidConvId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	message_id_str := ps.ByName("MessageId")
+	message_id, err := strconv.ParseInt(message_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid message_id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = rt.db.UnpinMessage(ctx.User_id, conversation_id, message_id)
+	if err != nil {
+		if err.Error() == constants.NotGroupAdmin {
+			ctx.Logger.WithError(err).Error(message + "user is not a group admin")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		ctx.Logger.WithError(err).Error(message + "conversation or pinned message not found")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info(message + "message " + message_id_str + " unpinned")
+}
+
+func (rt *_router) GetPinnedMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Get Pinned Messages: "
+
+	conversation_id_str := ps.ByName("ConversationId")
+	conversation_id, err := strconv.ParseInt(conversation_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.InvalidConvId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	pinned, err := rt.db.GetPinnedMessages(ctx.User_id, conversation_id)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "conversation not found")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(pinned)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "pinned messages of conversation " + conversation_id_str + " sended to client")
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/maisto1/WasaText/service/api/reqcontext"
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+const (
+	maxPollQuestionLength = 256
+	maxPollOptionLength   = 100
+	minPollOptions        = 2
+	maxPollOptions        = 10
+)
+
+// isValidPollMessage accepts a message of type poll, which carries its question in the poll rather than in the content
+func isValidPollMessage(mediaType, content string, media []byte, poll *models.PollDraft) bool {
+	return mediaType == "poll" && content == "" && len(media) == 0 && poll != nil && isValidPoll(*poll)
+}
+
+// isValidPoll checks the question and the options, which must be distinct, and that the poll doesn't close in the past
+func isValidPoll(poll models.PollDraft) bool {
+	if !isValidPollText(poll.Question, maxPollQuestionLength) {
+		return false
+	}
+
+	if len(poll.Options) < minPollOptions || len(poll.Options) > maxPollOptions {
+		return false
+	}
+
+	seen := make(map[string]bool, len(poll.Options))
+	for _, option := range poll.Options {
+		if !isValidPollText(option, maxPollOptionLength) || seen[option] {
+			return false
+		}
+		seen[option] = true
+	}
+
+	return poll.ClosesAt == nil || *poll.ClosesAt > globaltime.Now().Unix()
+}
+
+func isValidPollText(text string, maxLength int) bool {
+	return strings.TrimSpace(text) != "" && utf8.ValidString(text) && utf8.RuneCountInString(text) <= maxLength
+}
+
+func (rt *_router) VotePoll(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Vote Poll: "
+
+	conversation_id_str := ps.ByName("ConversationId")
+	conversation_id, err := strconv.ParseInt(conversation_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.InvalidConvId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	message_id_str := ps.ByName("MessageId")
+	message_id, err := strconv.ParseInt(message_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid message_id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var requestBody struct {
+		OptionIds []int64 `json:"optionIds"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(&requestBody)
+	if err != nil || requestBody.OptionIds == nil || len(requestBody.OptionIds) > maxPollOptions {
+		ctx.Logger.WithError(err).Error(message + constants.ErrDecBody)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// An empty list takes back the vote of the user
+	option_ids := make([]int64, 0, len(requestBody.OptionIds))
+	seen := make(map[int64]bool, len(requestBody.OptionIds))
+	for _, option_id := range requestBody.OptionIds {
+		if !seen[option_id] {
+			seen[option_id] = true
+			option_ids = append(option_ids, option_id)
+		}
+	}
+
+	poll, err := rt.db.VotePoll(ctx.User_id, conversation_id, message_id, option_ids)
+	if err != nil {
+		switch err.Error() {
+		case constants.PollClosed:
+			ctx.Logger.WithError(err).Error(message + "poll closed")
+			w.WriteHeader(http.StatusConflict)
+		case constants.InvalidPollVote:
+			ctx.Logger.WithError(err).Error(message + "invalid options")
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			ctx.Logger.WithError(err).Error(message + "conversation or poll not found")
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(poll)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "vote on poll " + message_id_str + " saved")
+}
+
+func (rt *_router) ClosePoll(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Close Poll: "
+
+	conversation_id_str := ps.ByName("ConversationId")
+	conversation_id, err := strconv.ParseInt(conversation_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.InvalidConvId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	message_id_str := ps.ByName("MessageId")
+	message_id, err := strconv.ParseInt(message_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid message_id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	poll, err := rt.db.ClosePoll(ctx.User_id, conversation_id, message_id)
+	if err != nil {
+		switch err.Error() {
+		case constants.NotMessageSender:
+			ctx.Logger.WithError(err).Error(message + "only the sender can close the poll")
+			w.WriteHeader(http.StatusForbidden)
+		case constants.PollClosed:
+			ctx.Logger.WithError(err).Error(message + "poll already closed")
+			w.WriteHeader(http.StatusConflict)
+		default:
+			ctx.Logger.WithError(err).Error(message + "conversation or poll not found")
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(poll)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "poll " + message_id_str + " closed")
+}
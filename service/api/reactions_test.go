@@ -0,0 +1,62 @@
+package api
+
+import "testing"
+
+func TestIsValidEmoji(t *testing.T) {
+	valid := []string{
+		"👍",
+		"❤️",
+		"👍🏽",
+		"👨‍👩‍👧‍👦",
+		"🏳️‍🌈",
+		"👩🏻‍💻",
+		"🇮🇹",
+		"1️⃣",
+		"#⃣",
+		"🏴\U000E0067\U000E0062\U000E0065\U000E006E\U000E0067\U000E007F",
+		"↔️",
+		"▶️",
+		"⌚",
+		"⭐",
+		"✔️",
+		"〰️",
+		"🫨",
+	}
+	for _, emoji := range valid {
+		if !isValidEmoji(emoji) {
+			t.Errorf("isValidEmoji(%q) = false, want true", emoji)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"a",
+		"1",
+		"👍👍👍",
+		"😀😂",
+		"👍 ",
+		"🏽",
+		"‍",
+		"👍‍",
+		"‍👍",
+		"🇮",
+		"🇮🇹🇫🇷",
+		"1️⃣2️⃣",
+		"1️⃣👍",
+		"👍🏽🏽",
+		"🏴\U000E0067\U000E0062",
+		"→",
+		"■",
+		"▲",
+		"✓",
+		"⬆️‍→",
+		"①",
+		"🄰",
+		"🜁",
+	}
+	for _, emoji := range invalid {
+		if isValidEmoji(emoji) {
+			t.Errorf("isValidEmoji(%q) = true, want false", emoji)
+		}
+	}
+}
@@ -19,6 +19,12 @@ type RequestContext struct {
 	// Id of the user that make the request
 	User_id int64
 
+	// Id of the session used to authenticate the request, 0 for bots
+	Session_id int64
+
+	// Whether the request is made by a bot with an API key
+	IsBot bool
+
 	// Logger is a custom field logger for the request
 	Logger logrus.FieldLogger
 }
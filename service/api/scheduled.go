@@ -0,0 +1,203 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/maisto1/WasaText/service/api/reqcontext"
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+)
+
+// scheduledMessageRequest is the body to schedule a message or change a scheduled one
+type scheduledMessageRequest struct {
+	Type    string `json:"type"`
+	Content string `json:"content"`
+	Media   []byte `json:"media"`
+	SendAt  int64  `json:"sendAt"`
+}
+
+// decodeScheduledMessage decodes the request body, which must hold a valid message to be sent in the future
+func decodeScheduledMessage(r *http.Request) (scheduledMessageRequest, bool) {
+	var requestBody scheduledMessageRequest
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&requestBody)
+	if err != nil || !isValidMessage(requestBody.Type, requestBody.Content, requestBody.Media) {
+		return requestBody, false
+	}
+
+	return requestBody, requestBody.SendAt > globaltime.Now().Unix()
+}
+
+func (rt *_router) CreateScheduledMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Create Scheduled Message: "
+
+	conversation_id_str := ps.ByName("ConversationId")
+	conversation_id, err := strconv.ParseInt(conversation_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.InvalidConvId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	requestBody, ok := decodeScheduledMessage(r)
+	if !ok {
+		ctx.Logger.Error(message + constants.ErrDecBody)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	scheduled, err := rt.db.CreateScheduledMessage(ctx.User_id, conversation_id, requestBody.Type, requestBody.Content, requestBody.Media, requestBody.SendAt)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "conversation not found")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	err = json.NewEncoder(w).Encode(scheduled)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "message scheduled with ID " + strconv.FormatInt(scheduled.Scheduled_id, 10))
+}
+
+func (rt *_router) GetScheduledMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Get Scheduled Messages: "
+
+	conversation_id_str := ps.ByName("ConversationId")
+	conversation_id, err := strconv.ParseInt(conversation_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.InvalidConvId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	scheduled, err := rt.db.GetScheduledMessages(ctx.User_id, conversation_id)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "conversation not found")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(scheduled)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "scheduled messages sended to client")
+}
+
+func (rt *_router) UpdateScheduledMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Update Scheduled Message: "
+
+	conversation_id_str := ps.ByName("ConversationId")
+	conversation_id, err := strconv.ParseInt(conversation_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.InvalidConvId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	scheduled_id_str := ps.ByName("ScheduledId")
+	scheduled_id, err := strconv.ParseInt(scheduled_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid scheduled_id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	requestBody, ok := decodeScheduledMessage(r)
+	if !ok {
+		ctx.Logger.Error(message + constants.ErrDecBody)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	scheduled, err := rt.db.UpdateScheduledMessage(ctx.User_id, conversation_id, scheduled_id, requestBody.Type, requestBody.Content, requestBody.Media, requestBody.SendAt)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "conversation or scheduled message not found")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(scheduled)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "scheduled message " + scheduled_id_str + " updated")
+}
+
+func (rt *_router) DeleteScheduledMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Delete Scheduled Message: "
+
+	conversation_id_str := ps.ByName("ConversationId")
+	conversation_id, err := strconv.ParseInt(conversation_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.InvalidConvId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	scheduled_id_str := ps.ByName("ScheduledId")
+	scheduled_id, err := strconv.ParseInt(scheduled_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid scheduled_id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = rt.db.DeleteScheduledMessage(ctx.User_id, conversation_id, scheduled_id)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "scheduled message not found")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info(message + "scheduled message " + scheduled_id_str + " cancelled")
+}
+
+// sendScheduledMessages sends the due scheduled messages as if their senders created them now
+func (rt *_router) sendScheduledMessages() error {
+	now := globaltime.Now().Unix()
+
+	due, err := rt.db.GetDueScheduledMessages(now)
+	if err != nil {
+		return err
+	}
+
+	// A message which can't be sent stays scheduled, and is tried again at the next run
+	for _, scheduled := range due {
+		_, err = rt.db.SendScheduledMessage(scheduled.Scheduled_id, now)
+		switch {
+		case err == nil:
+		case err.Error() == constants.ScheduledMessageNotFound:
+			// Cancelled or postponed by the sender in the meantime
+		case err.Error() == constants.NotPartecipant:
+			rt.baseLogger.WithError(err).Warningf("scheduler: dropped scheduled message %d", scheduled.Scheduled_id)
+		default:
+			rt.baseLogger.WithError(err).Warningf("scheduler: can't send scheduled message %d, retrying later", scheduled.Scheduled_id)
+		}
+	}
+
+	return nil
+}
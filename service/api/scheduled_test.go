@@ -0,0 +1,75 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/maisto1/WasaText/service/api"
+)
+
+func TestSchedulerSendsDueMessagesOnce(t *testing.T) {
+	router, db := newTestRouter(t, api.Config{})
+	setTime(t, 1700000000)
+
+	alice, err := db.Login("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Login("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conversation_id, err := db.CreateConversation(alice, "", "private", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.CreateScheduledMessage(alice, int64(conversation_id), "text", "Good morning", nil, 1700000060)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled, err := db.CreateScheduledMessage(alice, int64(conversation_id), "text", "Never mind", nil, 1700000060)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sent counts the messages in the conversation
+	sent := func() int {
+		messages, err := db.GetMessages(alice, int64(conversation_id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(messages)
+	}
+
+	err = api.SendScheduledMessages(router)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent() != 0 {
+		t.Fatalf("%d messages sent before their time", sent())
+	}
+
+	err = db.DeleteScheduledMessage(alice, int64(conversation_id), cancelled.Scheduled_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setTime(t, 1700000060)
+	for i := 0; i < 3; i++ {
+		err = api.SendScheduledMessages(router)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sent() != 1 {
+		t.Errorf("%d messages sent, want the one not cancelled sent once", sent())
+	}
+
+	pending, err := db.GetScheduledMessages(alice, int64(conversation_id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("%d messages still scheduled after the send", len(pending))
+	}
+}
@@ -0,0 +1,414 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/maisto1/WasaText/service/api/reqcontext"
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+const (
+	scimUserSchema    = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimListSchema    = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimPatchSchema   = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	scimErrorSchema   = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimContentType   = "application/scim+json"
+	scimMaxPageSize   = 100
+	scimUsersLocation = "/scim/v2/Users/"
+	scimInvalidFilter = "invalidFilter"
+	scimInvalidValue  = "invalidValue"
+	scimUniqueness    = "uniqueness"
+	scimInvalidSyntax = "invalidSyntax"
+	scimNoTarget      = "noTarget"
+	scimMutability    = "mutability"
+	scimInvalidPath   = "invalidPath"
+)
+
+// scimFilterPattern matches the only filters supported: equality on a single attribute
+var scimFilterPattern = regexp.MustCompile(`^(?i)(userName|externalId|active)\s+eq\s+(?:"((?:[^"\\]|\\.)*)"|(true|false))$`)
+
+type scimUser struct {
+	Schemas    []string `json:"schemas"`
+	Id         string   `json:"id"`
+	ExternalId string   `json:"externalId,omitempty"`
+	UserName   string   `json:"userName"`
+	Active     bool     `json:"active"`
+	Meta       struct {
+		ResourceType string `json:"resourceType"`
+		Location     string `json:"location"`
+	} `json:"meta"`
+}
+
+func newScimUser(account models.Account) scimUser {
+	user := scimUser{
+		Schemas:    []string{scimUserSchema},
+		Id:         strconv.FormatInt(account.User_id, 10),
+		ExternalId: account.ExternalId,
+		UserName:   account.Username,
+		Active:     account.Active,
+	}
+	user.Meta.ResourceType = "User"
+	user.Meta.Location = scimUsersLocation + user.Id
+	return user
+}
+
+func isValidUsername(username string) bool {
+	return len(username) >= constants.MinUsernameLength && len(username) <= constants.MaxUsernameLength
+}
+
+// scimAuth wraps the SCIM handlers, which are reserved to the identity management system holding the admin token.
+func (rt *_router) scimAuth(fn httpRouterHandler) httpRouterHandler {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+		if rt.scimToken == "" {
+			ctx.Logger.Error("ERROR scimAuth: SCIM provisioning not configured")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		token, err := ExtractToken_from_Bearer(r.Header.Get("Authorization"))
+		if err != nil || subtle.ConstantTimeCompare([]byte(token), []byte(rt.scimToken)) != 1 {
+			ctx.Logger.WithError(err).Error("ERROR scimAuth: invalid admin token")
+			writeScimError(w, http.StatusUnauthorized, "", "invalid admin token")
+			return
+		}
+
+		fn(w, r, ps, ctx)
+	}
+}
+
+func writeScimError(w http.ResponseWriter, status int, scimType string, detail string) {
+	response := struct {
+		Schemas  []string `json:"schemas"`
+		Status   string   `json:"status"`
+		ScimType string   `json:"scimType,omitempty"`
+		Detail   string   `json:"detail"`
+	}{
+		Schemas:  []string{scimErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	}
+
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func writeScim(w http.ResponseWriter, status int, v interface{}) error {
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (rt *_router) ScimGetUsers(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "SCIM Get Users: "
+	var filter models.AccountFilter
+
+	query := r.URL.Query()
+
+	if raw := strings.TrimSpace(query.Get("filter")); raw != "" {
+		match := scimFilterPattern.FindStringSubmatch(raw)
+		if match == nil {
+			ctx.Logger.Error(message + "unsupported filter " + raw)
+			writeScimError(w, http.StatusBadRequest, scimInvalidFilter, "only 'userName eq', 'externalId eq' and 'active eq' are supported")
+			return
+		}
+		value := strings.ReplaceAll(match[2], `\"`, `"`)
+		switch strings.ToLower(match[1]) {
+		case "username":
+			filter.Username = value
+		case "externalid":
+			filter.ExternalId = value
+		case "active":
+			active := strings.EqualFold(match[3], "true")
+			filter.Active = &active
+		}
+	}
+
+	start_index := 1
+	if raw := query.Get("startIndex"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			writeScimError(w, http.StatusBadRequest, scimInvalidValue, "invalid startIndex")
+			return
+		}
+		if value > 1 {
+			start_index = value
+		}
+	}
+
+	count := scimMaxPageSize
+	if raw := query.Get("count"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			writeScimError(w, http.StatusBadRequest, scimInvalidValue, "invalid count")
+			return
+		}
+		if value < 0 {
+			value = 0
+		}
+		if value < count {
+			count = value
+		}
+	}
+
+	accounts, total, err := rt.db.GetAccounts(filter, start_index, count)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "error retrieving users")
+		writeScimError(w, http.StatusInternalServerError, "", "internal server error")
+		return
+	}
+
+	resources := make([]scimUser, 0, len(accounts))
+	for _, account := range accounts {
+		resources = append(resources, newScimUser(account))
+	}
+
+	response := struct {
+		Schemas      []string   `json:"schemas"`
+		TotalResults int        `json:"totalResults"`
+		StartIndex   int        `json:"startIndex"`
+		ItemsPerPage int        `json:"itemsPerPage"`
+		Resources    []scimUser `json:"Resources"`
+	}{
+		Schemas:      []string{scimListSchema},
+		TotalResults: total,
+		StartIndex:   start_index,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+
+	err = writeScim(w, http.StatusOK, response)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "users sended to client")
+}
+
+func (rt *_router) ScimGetUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "SCIM Get User: "
+
+	user_id, err := strconv.ParseInt(ps.ByName("UserId"), 10, 64)
+	if err != nil {
+		writeScimError(w, http.StatusNotFound, "", "user not found")
+		return
+	}
+
+	account, err := rt.db.GetAccount(user_id)
+	if err != nil {
+		if err.Error() == constants.UserNotFound {
+			writeScimError(w, http.StatusNotFound, "", "user not found")
+			return
+		}
+		ctx.Logger.WithError(err).Error(message + "error retrieving user")
+		writeScimError(w, http.StatusInternalServerError, "", "internal server error")
+		return
+	}
+
+	err = writeScim(w, http.StatusOK, newScimUser(account))
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "user sended to client")
+}
+
+func (rt *_router) ScimCreateUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "SCIM Create User: "
+
+	// Unknown attributes (e.g. name, emails) are ignored, as SCIM clients send them routinely
+	var requestBody struct {
+		UserName   string `json:"userName"`
+		ExternalId string `json:"externalId"`
+		Active     *bool  `json:"active"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&requestBody)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrDecBody)
+		writeScimError(w, http.StatusBadRequest, scimInvalidSyntax, "invalid request body")
+		return
+	}
+	if !isValidUsername(requestBody.UserName) {
+		writeScimError(w, http.StatusBadRequest, scimInvalidValue, "userName must be "+
+			strconv.Itoa(constants.MinUsernameLength)+" to "+strconv.Itoa(constants.MaxUsernameLength)+" bytes long")
+		return
+	}
+
+	active := true
+	if requestBody.Active != nil {
+		active = *requestBody.Active
+	}
+
+	account, err := rt.db.CreateAccount(requestBody.UserName, requestBody.ExternalId, active)
+	if err != nil {
+		if err.Error() == constants.UsernameTaken {
+			writeScimError(w, http.StatusConflict, scimUniqueness, "userName already exists")
+			return
+		}
+		ctx.Logger.WithError(err).Error(message + "can't create the user")
+		writeScimError(w, http.StatusInternalServerError, "", "internal server error")
+		return
+	}
+
+	user := newScimUser(account)
+	w.Header().Set("Location", user.Meta.Location)
+
+	err = writeScim(w, http.StatusCreated, user)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "user provisioned with ID " + user.Id)
+}
+
+func (rt *_router) ScimPatchUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "SCIM Patch User: "
+
+	user_id, err := strconv.ParseInt(ps.ByName("UserId"), 10, 64)
+	if err != nil {
+		writeScimError(w, http.StatusNotFound, "", "user not found")
+		return
+	}
+
+	var requestBody struct {
+		Schemas    []string `json:"schemas"`
+		Operations []struct {
+			Op    string          `json:"op"`
+			Path  string          `json:"path"`
+			Value json.RawMessage `json:"value"`
+		} `json:"Operations"`
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&requestBody)
+	if err != nil || len(requestBody.Operations) == 0 {
+		ctx.Logger.WithError(err).Error(message + constants.ErrDecBody)
+		writeScimError(w, http.StatusBadRequest, scimInvalidSyntax, "invalid PatchOp body")
+		return
+	}
+
+	var username *string
+	var external_id *string
+	var active *bool
+
+	// apply sets a single attribute; values of "active" may come as strings from some clients
+	apply := func(path string, value json.RawMessage) string {
+		switch strings.ToLower(path) {
+		case "username":
+			var v string
+			if json.Unmarshal(value, &v) != nil || !isValidUsername(v) {
+				return scimInvalidValue
+			}
+			username = &v
+		case "externalid":
+			var v string
+			if json.Unmarshal(value, &v) != nil {
+				return scimInvalidValue
+			}
+			external_id = &v
+		case "active":
+			var v bool
+			if json.Unmarshal(value, &v) != nil {
+				var s string
+				if json.Unmarshal(value, &s) != nil || (s != "true" && s != "false") {
+					return scimInvalidValue
+				}
+				v = s == "true"
+			}
+			active = &v
+		case "id":
+			return scimMutability
+		default:
+			return scimInvalidPath
+		}
+		return ""
+	}
+
+	for _, operation := range requestBody.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != "replace" && op != "add" {
+			writeScimError(w, http.StatusBadRequest, scimInvalidSyntax, "only add and replace operations are supported")
+			return
+		}
+
+		if operation.Path != "" {
+			if scimType := apply(operation.Path, operation.Value); scimType != "" {
+				writeScimError(w, http.StatusBadRequest, scimType, "can't apply operation on "+operation.Path)
+				return
+			}
+			continue
+		}
+
+		var values map[string]json.RawMessage
+		if json.Unmarshal(operation.Value, &values) != nil {
+			writeScimError(w, http.StatusBadRequest, scimNoTarget, "operation without path needs an object value")
+			return
+		}
+		for path, value := range values {
+			if scimType := apply(path, value); scimType != "" {
+				writeScimError(w, http.StatusBadRequest, scimType, "can't apply operation on "+path)
+				return
+			}
+		}
+	}
+
+	account, err := rt.db.UpdateAccount(user_id, username, external_id, active)
+	if err != nil {
+		if err.Error() == constants.UserNotFound {
+			writeScimError(w, http.StatusNotFound, "", "user not found")
+			return
+		}
+		if err.Error() == constants.UsernameTaken {
+			writeScimError(w, http.StatusConflict, scimUniqueness, "userName already exists")
+			return
+		}
+		ctx.Logger.WithError(err).Error(message + "can't update the user")
+		writeScimError(w, http.StatusInternalServerError, "", "internal server error")
+		return
+	}
+
+	err = writeScim(w, http.StatusOK, newScimUser(account))
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "user " + ps.ByName("UserId") + " updated")
+}
+
+// ScimDeleteUser deactivates the user instead of deleting it, so that its messages stay in the conversations.
+func (rt *_router) ScimDeleteUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "SCIM Delete User: "
+
+	user_id, err := strconv.ParseInt(ps.ByName("UserId"), 10, 64)
+	if err != nil {
+		writeScimError(w, http.StatusNotFound, "", "user not found")
+		return
+	}
+
+	inactive := false
+	_, err = rt.db.UpdateAccount(user_id, nil, nil, &inactive)
+	if err != nil {
+		if err.Error() == constants.UserNotFound {
+			writeScimError(w, http.StatusNotFound, "", "user not found")
+			return
+		}
+		ctx.Logger.WithError(err).Error(message + "can't deactivate the user")
+		writeScimError(w, http.StatusInternalServerError, "", "internal server error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info(message + "user " + ps.ByName("UserId") + " deactivated")
+}
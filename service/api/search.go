@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/maisto1/WasaText/service/api/reqcontext"
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+// parseTimeParam returns the unix time in the query parameter name, 0 if missing
+func parseTimeParam(r *http.Request, name string) (int64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	timestamp, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if timestamp < 0 {
+		return 0, errors.New(name + " can't be negative")
+	}
+
+	return timestamp, nil
+}
+
+func (rt *_router) SearchMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Search Messages: "
+
+	var filter models.SearchFilter
+	var err error
+
+	query := r.URL.Query()
+
+	filter.Text = strings.TrimSpace(query.Get("q"))
+	filter.Sender = query.Get("sender")
+	filter.Type = query.Get("type")
+	if filter.Text == "" || (filter.Type != "" && filter.Type != "text" && filter.Type != "media") {
+		ctx.Logger.Error(message + "missing search text or invalid type")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	filter.Conversation_id, err = parseIdParam(r, "conversation")
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.InvalidConvId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	filter.From, err = parseTimeParam(r, "from")
+	if err == nil {
+		filter.To, err = parseTimeParam(r, "to")
+	}
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid date range")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	filter.Limit, err = parseLimitParam(r)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid limit")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	hits, err := rt.db.SearchMessages(ctx.User_id, filter)
+	if err != nil {
+		if err.Error() == constants.SearchUnavailable {
+			ctx.Logger.WithError(err).Error(message + "rebuild with the sqlite_fts5 tag to enable search")
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		ctx.Logger.WithError(err).Error(message + "conversation not found")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(hits)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + strconv.Itoa(len(hits)) + " results sended to client")
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/maisto1/WasaText/service/api/reqcontext"
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+)
+
+func (rt *_router) GetSessions(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Get Sessions: "
+
+	sessions, err := rt.db.GetSessions(ctx.User_id)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "error retrieving sessions")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].Session_id == ctx.Session_id
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(sessions)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.Info(message + "sessions sended to client")
+}
+
+func (rt *_router) RevokeSession(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Revoke Session: "
+
+	session_id_str := ps.ByName("SessionId")
+	session_id, err := strconv.ParseInt(session_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid session_id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = rt.db.RevokeSession(ctx.User_id, session_id)
+	if err != nil {
+		if err.Error() == constants.SessionNotFound {
+			ctx.Logger.WithError(err).Error(message + "session not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		ctx.Logger.WithError(err).Error(message + "can't revoke the session")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info(message + "session revoked")
+}
+
+func (rt *_router) RevokeSessions(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Revoke Sessions: "
+
+	// The current session is revoked too, so that a stolen token can't survive a "log out everywhere"
+	err := rt.db.RevokeSessions(ctx.User_id)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "can't revoke the sessions")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info(message + "sessions revoked")
+}
+
+// sweepExpiredSessions deletes the sessions expired, which can't be used anymore
+func (rt *_router) sweepExpiredSessions() error {
+	deleted, err := rt.db.DeleteExpiredSessions(globaltime.Now().Unix())
+	if deleted > 0 {
+		rt.baseLogger.Infof("sweeper: %d expired sessions deleted", deleted)
+	}
+	return err
+}
@@ -0,0 +1,35 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/maisto1/WasaText/service/api"
+)
+
+func TestRevokeSessionsLogsOutEveryDevice(t *testing.T) {
+	router, _ := newTestRouter(t, api.Config{})
+	server := httptest.NewServer(router.Handler())
+	t.Cleanup(server.Close)
+
+	var phone, laptop session
+	for _, s := range []*session{&phone, &laptop} {
+		status := request(t, http.MethodPost, server.URL+"/session", "", map[string]string{"username": "alice"}, s)
+		if status != http.StatusCreated {
+			t.Fatalf("login: status %d", status)
+		}
+	}
+
+	status := request(t, http.MethodDelete, server.URL+"/users/profile/sessions", laptop.Token, nil, nil)
+	if status != http.StatusNoContent {
+		t.Fatalf("revoke the sessions: status %d", status)
+	}
+
+	for name, s := range map[string]session{"phone": phone, "laptop": laptop} {
+		status = request(t, http.MethodGet, server.URL+"/users/profile/sessions", s.Token, nil, nil)
+		if status != http.StatusUnauthorized {
+			t.Errorf("session of the %s after the revocation: status %d, want %d", name, status, http.StatusUnauthorized)
+		}
+	}
+}
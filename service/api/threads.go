@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/maisto1/WasaText/service/api/reqcontext"
+	"github.com/maisto1/WasaText/service/constants"
+)
+
+func (rt *_router) CreateThreadReply(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Create Thread Reply: "
+
+	conversation_id_str := ps.ByName("ConversationId")
+	conversation_id, err := strconv.ParseInt(conversation_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.InvalidConvId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	message_id_str := ps.ByName("MessageId")
+	message_id, err := strconv.ParseInt(message_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid message_id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var requestBody struct {
+		Type            string `json:"type"`
+		Content         string `json:"content"`
+		Media           []byte `json:"media"`
+		ClientMessageId string `json:"clientMessageId"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(&requestBody)
+	if err != nil || !(isValidMessage(requestBody.Type, requestBody.Content, requestBody.Media)) {
+		ctx.Logger.WithError(err).Error(message + constants.ErrDecBody)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	client_message_id, ok := parseClientMessageId(requestBody.ClientMessageId)
+	if !ok {
+		ctx.Logger.Error(message + "invalid client message id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	reply, err := rt.db.CreateThreadReply(ctx.User_id, conversation_id, message_id, requestBody.Type, requestBody.Content, requestBody.Media, client_message_id)
+	if err != nil && err.Error() == constants.DuplicateClientMessageId {
+		rt.replayClientMessage(w, ctx, message, client_message_id)
+		return
+	}
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "conversation or message not found")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	err = json.NewEncoder(w).Encode(reply)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "reply sent in the thread of message " + strconv.FormatInt(*reply.ThreadRootId, 10))
+}
+
+func (rt *_router) GetThread(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Get Thread: "
+
+	conversation_id_str := ps.ByName("ConversationId")
+	conversation_id, err := strconv.ParseInt(conversation_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.InvalidConvId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	message_id_str := ps.ByName("MessageId")
+	message_id, err := strconv.ParseInt(message_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid message_id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	before, err := parseIdParam(r, "before")
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid before cursor")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	after, err := parseIdParam(r, "after")
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid after cursor")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	limit, err := parseLimitParam(r)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid limit")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	thread, err := rt.db.GetThread(ctx.User_id, conversation_id, message_id, before, after, limit)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "conversation or message not found")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(thread)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "thread of message " + message_id_str + " sended to client")
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/maisto1/WasaText/service/globaltime"
+)
+
+const (
+	// maxFailedAttempts is how many attempts can fail in a row before the next ones are refused
+	maxFailedAttempts = 5
+
+	// throttleDelay is how long the attempts are refused after maxFailedAttempts failures. It doubles with every
+	// further failure, up to maxThrottleDelay, and the failures are forgotten maxThrottleDelay after the last one.
+	throttleDelay    = time.Minute
+	maxThrottleDelay = time.Hour
+)
+
+// throttle counts the failed attempts of each key, e.g. a username or an IP address, and refuses the attempts of a
+// key for a while after too many failures, so that passwords and codes can't be guessed.
+type throttle struct {
+	mu        sync.Mutex
+	failures  map[string]*failedAttempts
+	nextPrune time.Time
+}
+
+type failedAttempts struct {
+	count int
+	last  time.Time
+	until time.Time
+}
+
+func newThrottle() *throttle {
+	return &throttle{failures: make(map[string]*failedAttempts)}
+}
+
+// wait returns how long the attempts of the keys are still refused, zero if they are allowed
+func (t *throttle) wait(keys ...string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := globaltime.Now()
+	var wait time.Duration
+	for _, key := range keys {
+		failures, ok := t.failures[key]
+		if ok && failures.until.Sub(now) > wait {
+			wait = failures.until.Sub(now)
+		}
+	}
+
+	return wait
+}
+
+// fail records a failed attempt of the keys
+func (t *throttle) fail(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := globaltime.Now()
+	t.prune(now)
+
+	for _, key := range keys {
+		failures, ok := t.failures[key]
+		if !ok || now.Sub(failures.last) >= maxThrottleDelay {
+			failures = &failedAttempts{}
+			t.failures[key] = failures
+		}
+
+		failures.count++
+		failures.last = now
+		if failures.count >= maxFailedAttempts {
+			delay := maxThrottleDelay
+			if shift := failures.count - maxFailedAttempts; shift < 6 {
+				delay = throttleDelay << shift
+			}
+			if delay > maxThrottleDelay {
+				delay = maxThrottleDelay
+			}
+			failures.until = now.Add(delay)
+		}
+	}
+}
+
+// reset forgets the failed attempts of the keys, after a successful one
+func (t *throttle) reset(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, key := range keys {
+		delete(t.failures, key)
+	}
+}
+
+// prune forgets the failures older than maxThrottleDelay, at most once every maxThrottleDelay
+func (t *throttle) prune(now time.Time) {
+	if now.Before(t.nextPrune) {
+		return
+	}
+	t.nextPrune = now.Add(maxThrottleDelay)
+
+	for key, failures := range t.failures {
+		if now.Sub(failures.last) >= maxThrottleDelay {
+			delete(t.failures, key)
+		}
+	}
+}
+
+// tooManyAttempts answers that the attempts are refused for wait
+func tooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	w.WriteHeader(http.StatusTooManyRequests)
+}
+
+// remoteIP returns the IP address of the client of the request, without the port
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
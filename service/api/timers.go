@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/maisto1/WasaText/service/api/reqcontext"
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+)
+
+// messageTimers are the disappearing messages timers, in seconds, a conversation can be set to. 0 turns it off.
+var messageTimers = map[int64]bool{
+	0:       true,
+	3600:    true, // 1h
+	86400:   true, // 24h
+	604800:  true, // 7d
+	7776000: true, // 90d
+}
+
+func (rt *_router) SetMessageTimer(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Set Message Timer: "
+
+	conversation_id_str := ps.ByName("ConversationId")
+	conversation_id, err := strconv.ParseInt(conversation_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.InvalidConvId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var requestBody struct {
+		TTL int64 `json:"ttl"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(&requestBody)
+	if err != nil || !messageTimers[requestBody.TTL] {
+		ctx.Logger.Error(message + constants.ErrDecBody)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	notice, err := rt.db.SetMessageTimer(ctx.User_id, conversation_id, requestBody.TTL)
+	if err != nil {
+		if err.Error() == constants.NotGroupAdmin {
+			ctx.Logger.WithError(err).Error(message + "user is not a group admin")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		ctx.Logger.WithError(err).Error(message + "conversation not found")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(notice)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "timer of conversation " + conversation_id_str + " set to " + strconv.FormatInt(requestBody.TTL, 10) + "s")
+}
+
+// sweepExpiredMessages deletes the disappearing messages whose timer ran out, with their media and comments
+func (rt *_router) sweepExpiredMessages() error {
+	deleted, err := rt.db.DeleteExpiredMessages(globaltime.Now().Unix())
+	if deleted > 0 {
+		rt.baseLogger.Infof("sweeper: %d expired messages deleted", deleted)
+	}
+	return err
+}
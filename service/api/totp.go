@@ -0,0 +1,275 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/maisto1/WasaText/service/api/reqcontext"
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/totp"
+)
+
+const (
+	totpIssuer         = "WasaText"
+	recoveryCodesCount = 10
+)
+
+// newRecoveryCodes returns the recovery codes shown once to the user, in the form "xxxxx-xxxxx".
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, recoveryCodesCount)
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	for i := 0; i < recoveryCodesCount; i++ {
+		buf := make([]byte, 7)
+		_, err := rand.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(buf))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+
+	return codes, nil
+}
+
+// hashRecoveryCode hashes the code ignoring case, spaces and dashes, so that it can be typed loosely.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(code)
+	normalized = strings.ReplaceAll(normalized, "-", "")
+	normalized = strings.ReplaceAll(normalized, " ", "")
+	return hashToken(normalized)
+}
+
+// secondFactorAttempt is the key throttling the second factor of a user
+func secondFactorAttempt(user_id int64) string {
+	return "totp:" + strconv.FormatInt(user_id, 10)
+}
+
+// checkSecondFactor verifies the TOTP code or, in alternative, the recovery code of a user with TOTP enabled. After too
+// many wrong codes in a row, the codes of the user aren't checked for a while.
+func (rt *_router) checkSecondFactor(user_id int64, code string, recoveryCode string) (bool, error) {
+	secret, enabled, _, err := rt.db.GetTotp(user_id)
+	if err != nil {
+		return false, err
+	}
+	if !enabled {
+		return true, nil
+	}
+	if code == "" && recoveryCode == "" {
+		return false, nil
+	}
+
+	attempt := secondFactorAttempt(user_id)
+	if rt.attempts.wait(attempt) > 0 {
+		return false, errors.New(constants.TooManyFailedAttempts)
+	}
+
+	var ok bool
+	if code != "" {
+		// The last step read here may already be stale, so replays are refused by SetTotpStep only
+		step, valid := totp.Validate(secret, code, 0)
+		if valid {
+			ok, err = rt.db.SetTotpStep(user_id, step)
+		}
+	} else {
+		ok, err = rt.db.UseRecoveryCode(user_id, hashRecoveryCode(recoveryCode))
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !ok {
+		rt.attempts.fail(attempt)
+		return false, nil
+	}
+	rt.attempts.reset(attempt)
+	return true, nil
+}
+
+func (rt *_router) EnrollTotp(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Enroll TOTP: "
+
+	_, enabled, _, err := rt.db.GetTotp(ctx.User_id)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "error retrieving TOTP status")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		ctx.Logger.Error(message + "TOTP already enabled")
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	user, err := rt.db.GetUser(ctx.User_id)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "user not found")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "can't generate the secret")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = rt.db.SetTotpSecret(ctx.User_id, secret)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "can't store the secret")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, user.Username, secret),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.Info(message + "enrollment started")
+}
+
+func (rt *_router) ConfirmTotp(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Confirm TOTP: "
+
+	var requestBody struct {
+		Code string `json:"code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&requestBody)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrDecBody)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	secret, enabled, _, err := rt.db.GetTotp(ctx.User_id)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "error retrieving TOTP status")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if secret == "" {
+		ctx.Logger.Error(message + "no enrollment in progress")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if enabled {
+		ctx.Logger.Error(message + "TOTP already enabled")
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	step, ok := totp.Validate(secret, requestBody.Code, 0)
+	if !ok {
+		ctx.Logger.Error(message + "invalid code")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "can't generate recovery codes")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	err = rt.db.EnableTotp(ctx.User_id, step, hashes)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "can't enable TOTP")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}{
+		RecoveryCodes: codes,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.Info(message + "TOTP enabled")
+}
+
+func (rt *_router) DisableTotp(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Disable TOTP: "
+
+	var requestBody struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&requestBody)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrDecBody)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ok, err := rt.checkSecondFactor(ctx.User_id, requestBody.Code, requestBody.RecoveryCode)
+	if err != nil && err.Error() == constants.TooManyFailedAttempts {
+		ctx.Logger.WithError(err).Error(message + "too many wrong codes")
+		tooManyAttempts(w, rt.attempts.wait(secondFactorAttempt(ctx.User_id)))
+		return
+	}
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "error checking the code")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		ctx.Logger.Error(message + "invalid code")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	err = rt.db.DisableTotp(ctx.User_id)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "can't disable TOTP")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info(message + "TOTP disabled")
+}
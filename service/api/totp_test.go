@@ -0,0 +1,77 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/maisto1/WasaText/service/api"
+	"github.com/maisto1/WasaText/service/totp"
+)
+
+func TestLoginThrottlesWrongTotpCodes(t *testing.T) {
+	router, db := newTestRouter(t, api.Config{})
+	server := httptest.NewServer(router.Handler())
+	t.Cleanup(server.Close)
+	setTime(t, 1700000000)
+
+	alice, err := db.Login("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.SetTotpSecret(alice, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.EnableTotp(alice, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// codeAt returns the code of the step of unix
+	codeAt := func(unix int64) string {
+		code, err := totp.Code(secret, totp.Step(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+	wrong := "000000"
+	for _, unix := range []int64{1699999970, 1700000000, 1700000030, 1700000060, 1700000090} {
+		if codeAt(unix) == wrong {
+			wrong = "111111"
+		}
+	}
+
+	login := func(code string) int {
+		return request(t, http.MethodPost, server.URL+"/session", "", map[string]string{"username": "alice", "totpCode": code}, nil)
+	}
+
+	// Asking for the code isn't a failure
+	for i := 0; i < 10; i++ {
+		if status := login(""); status != http.StatusUnauthorized {
+			t.Fatalf("login without code: status %d, want %d", status, http.StatusUnauthorized)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		if status := login(wrong); status != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d: status %d, want %d", i+1, status, http.StatusUnauthorized)
+		}
+	}
+
+	// Even the right code is refused until the delay passes
+	if status := login(codeAt(1700000000)); status != http.StatusTooManyRequests {
+		t.Errorf("login after too many wrong codes: status %d, want %d", status, http.StatusTooManyRequests)
+	}
+
+	setTime(t, 1700000061)
+	if status := login(codeAt(1700000061)); status != http.StatusCreated {
+		t.Errorf("login after the delay: status %d, want %d", status, http.StatusCreated)
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/maisto1/WasaText/service/api/reqcontext"
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+)
+
+func (rt *_router) RestoreMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Restore Message: "
+
+	conversation_id_str := ps.ByName("ConversationId")
+	conversation_id, err := strconv.ParseInt(conversation_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.InvalidConvId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	message_id_str := ps.ByName("MessageId")
+	message_id, err := strconv.ParseInt(message_id_str, 10, 64)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "invalid message_id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	deleted_after := globaltime.Now().Add(-rt.undoWindow).Unix()
+	err = rt.db.RestoreMessage(ctx.User_id, conversation_id, message_id, deleted_after)
+	if err != nil {
+		switch err.Error() {
+		case constants.NotMessageSender:
+			ctx.Logger.WithError(err).Error(message + "message deleted by another user")
+			w.WriteHeader(http.StatusForbidden)
+		case constants.UndoWindowExpired:
+			ctx.Logger.WithError(err).Error(message + "message can't be restored anymore")
+			w.WriteHeader(http.StatusGone)
+		default:
+			ctx.Logger.WithError(err).Error(message + "conversation or deleted message not found")
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info(message + "message " + message_id_str + " restored")
+}
+
+func (rt *_router) GetTrash(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Get Trash: "
+
+	trash, err := rt.db.GetTrash(ctx.User_id, globaltime.Now().Add(-rt.undoWindow).Unix())
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "error retrieving deleted messages")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	undo_window := int64(rt.undoWindow.Seconds())
+	for i := range trash {
+		trash[i].ExpiresAt = trash[i].DeletedAt + undo_window
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(trash)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + constants.ErrParsing)
+		return
+	}
+
+	ctx.Logger.Info(message + "deleted messages sended to client")
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
@@ -73,7 +74,7 @@ func (rt *_router) EditProfileName(w http.ResponseWriter, r *http.Request, ps ht
 	decoder := json.NewDecoder(r.Body)
 	decoder.DisallowUnknownFields()
 	err := decoder.Decode(&requestBody)
-	if err != nil {
+	if err != nil || len(requestBody.Username) < constants.MinUsernameLength || len(requestBody.Username) > constants.MaxUsernameLength {
 		ctx.Logger.WithError(err).Error(message + constants.ErrDecBody)
 		w.WriteHeader(http.StatusBadRequest)
 		return
@@ -96,3 +97,61 @@ func (rt *_router) EditProfileName(w http.ResponseWriter, r *http.Request, ps ht
 	w.WriteHeader(http.StatusNoContent)
 	ctx.Logger.Info(message + "username updated successfully")
 }
+
+func (rt *_router) EditProfilePassword(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	message := "Edit Profile password: "
+	var requestBody struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&requestBody)
+	if err != nil || len(requestBody.NewPassword) < 8 || len(requestBody.NewPassword) > 256 {
+		ctx.Logger.WithError(err).Error(message + constants.ErrDecBody)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// A stolen session token doesn't allow guessing the current password at length either
+	attempt := "user:" + strconv.FormatInt(ctx.User_id, 10)
+	if wait := rt.attempts.wait(attempt); wait > 0 {
+		ctx.Logger.Error(message + "too many wrong current passwords")
+		tooManyAttempts(w, wait)
+		return
+	}
+
+	current_hash, err := rt.db.GetPasswordHash(ctx.User_id)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "error retrieving user credentials")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if current_hash != "" && !checkPassword(current_hash, requestBody.CurrentPassword) {
+		rt.attempts.fail(attempt)
+		ctx.Logger.Error(message + "wrong current password")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	rt.attempts.reset(attempt)
+
+	new_hash, err := hashPassword(requestBody.NewPassword)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "can't hash the password")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Every other session is revoked, so that devices logged in with the old password must log in again
+	err = rt.db.SetPassword(ctx.User_id, new_hash, ctx.Session_id)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(message + "can't update the password")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info(message + "password updated successfully")
+}
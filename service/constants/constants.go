@@ -8,4 +8,71 @@ const (
 	ErrDecBody = "error decoding request body"
 
 	NoGroupChat = "this isn't a group chat"
+
+	NotPartecipant = "user is not a partecipant"
+
+	SessionNotFound = "session not found"
+
+	SessionExpired = "session expired"
+
+	BotAccount = "bots can't log in"
+
+	UserDeactivated = "user deactivated"
+
+	UserNotFound = "user not found"
+
+	BotNotFound = "bot not found"
+
+	ApiKeyNotFound = "api key not found"
+
+	UsernameTaken = "username already exists"
+
+	TooManyFailedAttempts = "too many failed attempts, try again later"
+
+	OidcStateNotFound = "single sign-on login not found or expired"
+
+	ExternalAccount = "account managed by an identity provider or SCIM needs a password"
+
+	MessageNotFound = "message not found"
+
+	NotMessageSender = "this message doesn't belong to this user"
+
+	NotTextMessage = "only text messages can be edited"
+
+	EditWindowExpired = "message too old to be edited"
+
+	UndoWindowExpired = "message deleted too long ago to be restored"
+
+	ScheduledMessageNotFound = "scheduled message not found"
+
+	NotGroupAdmin = "only group admins can do this"
+
+	DuplicateClientMessageId = "client message id already used"
+
+	SearchUnavailable = "full-text search is not available in this build"
+
+	InboxItemNotFound = "inbox item not found"
+
+	MessageAlreadyPinned = "message already pinned"
+
+	MessageNotPinned = "message not pinned"
+
+	TooManyPins = "too many pinned messages"
+
+	NotAPoll = "message is not a poll"
+
+	PollClosed = "poll closed"
+
+	InvalidPollVote = "invalid poll options"
+
+	NotLiveLocation = "message is not a live location"
+
+	LiveLocationEnded = "live location sharing ended"
+)
+
+// Bounds of the length of a username, in bytes
+const (
+	MinUsernameLength = 3
+
+	MaxUsernameLength = 16
 )
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+func (db *appdbimpl) CreateAccount(username string, external_id string, active bool) (models.Account, error) {
+	var account models.Account
+	var exists bool
+
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM Users WHERE username = ?)", username).Scan(&exists)
+	if err != nil {
+		return account, err
+	}
+	if exists {
+		return account, errors.New(constants.UsernameTaken)
+	}
+
+	// Provisioned accounts have no password, so they can't log in with the username only until they set one
+	err = db.c.QueryRow(`
+		INSERT INTO Users (username, external_id, active, provisioned) VALUES (?, NULLIF(?, ''), ?, 1) RETURNING user_id;`,
+		username, external_id, active,
+	).Scan(&account.User_id)
+	if err != nil {
+		return account, err
+	}
+
+	account.Username = username
+	account.ExternalId = external_id
+	account.Active = active
+
+	return account, nil
+}
+
+func (db *appdbimpl) GetAccount(user_id int64) (models.Account, error) {
+	var account models.Account
+
+	err := db.c.QueryRow(`
+		SELECT user_id, username, COALESCE(external_id, ''), active
+		FROM Users
+		WHERE user_id = ? AND kind = 'user'`,
+		user_id,
+	).Scan(&account.User_id, &account.Username, &account.ExternalId, &account.Active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return account, errors.New(constants.UserNotFound)
+	}
+	if err != nil {
+		return account, err
+	}
+
+	return account, nil
+}
+
+func (db *appdbimpl) GetAccounts(filter models.AccountFilter, start_index int, count int) ([]models.Account, int, error) {
+	accounts := make([]models.Account, 0)
+	var total int
+
+	where := `WHERE kind = 'user'`
+	args := make([]interface{}, 0)
+	if filter.Username != "" {
+		where += ` AND username = ?`
+		args = append(args, filter.Username)
+	}
+	if filter.ExternalId != "" {
+		where += ` AND external_id = ?`
+		args = append(args, filter.ExternalId)
+	}
+	if filter.Active != nil {
+		where += ` AND active = ?`
+		args = append(args, *filter.Active)
+	}
+
+	err := db.c.QueryRow(`SELECT COUNT(*) FROM Users `+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.c.Query(`
+		SELECT user_id, username, COALESCE(external_id, ''), active
+		FROM Users `+where+`
+		ORDER BY user_id
+		LIMIT ? OFFSET ?`,
+		append(args, count, start_index-1)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var account models.Account
+		err = rows.Scan(&account.User_id, &account.Username, &account.ExternalId, &account.Active)
+		if err != nil {
+			return nil, 0, err
+		}
+		accounts = append(accounts, account)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return accounts, total, nil
+}
+
+func (db *appdbimpl) UpdateAccount(user_id int64, username *string, external_id *string, active *bool) (models.Account, error) {
+	account, err := db.GetAccount(user_id)
+	if err != nil {
+		return account, err
+	}
+
+	if username != nil && *username != account.Username {
+		var exists bool
+		err = db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM Users WHERE username = ?)", *username).Scan(&exists)
+		if err != nil {
+			return account, err
+		}
+		if exists {
+			return account, errors.New(constants.UsernameTaken)
+		}
+		account.Username = *username
+	}
+	if external_id != nil {
+		account.ExternalId = *external_id
+	}
+	if active != nil {
+		account.Active = *active
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return account, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE Users SET username = ?, external_id = NULLIF(?, ''), active = ? WHERE user_id = ?;`,
+		account.Username, account.ExternalId, account.Active, user_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return account, err
+	}
+
+	if !account.Active {
+		_, err = tx.Exec("DELETE FROM Sessions WHERE user_id = ?;", user_id)
+		if err != nil {
+			_ = tx.Rollback()
+			return account, err
+		}
+
+		_, err = tx.Exec(`
+			DELETE FROM ApiKeys
+			WHERE bot_id IN (SELECT user_id FROM Users WHERE kind = 'bot' AND owner_id = ?);`,
+			user_id)
+		if err != nil {
+			_ = tx.Rollback()
+			return account, err
+		}
+	}
+
+	return account, tx.Commit()
+}
@@ -0,0 +1,28 @@
+package database
+
+import "strings"
+
+// batchSize is how many ids forEachBatch passes at once, below the SQLite limit of arguments of a query
+const batchSize = 500
+
+// forEachBatch calls query with the ids split in batches, along with the placeholders for an IN list of the batch
+func forEachBatch(ids []interface{}, query func(placeholders string, batch []interface{}) error) error {
+	for start := 0; start < len(ids); start += batchSize {
+		end := start + batchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		err := query(placeholderList(end-start), ids[start:end])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// placeholderList returns n comma separated placeholders, for an IN list
+func placeholderList(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
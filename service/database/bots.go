@@ -0,0 +1,208 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+func (db *appdbimpl) CreateBot(owner_id int64, username string) (models.User, error) {
+	var bot models.User
+	var exists bool
+
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM Users WHERE username = ?)", username).Scan(&exists)
+	if err != nil {
+		return bot, err
+	}
+	if exists {
+		return bot, errors.New(constants.UsernameTaken)
+	}
+
+	err = db.c.QueryRow(`
+		INSERT INTO Users (username, kind, owner_id) VALUES (?, 'bot', ?) RETURNING user_id;`,
+		username, owner_id,
+	).Scan(&bot.User_id)
+	if err != nil {
+		return bot, err
+	}
+
+	bot.Username = username
+	bot.IsBot = true
+
+	return bot, nil
+}
+
+func (db *appdbimpl) GetBots(owner_id int64) ([]models.User, error) {
+	bots := make([]models.User, 0)
+
+	rows, err := db.c.Query(`
+		SELECT user_id, username, profile_photo
+		FROM Users
+		WHERE kind = 'bot' AND owner_id = ?`,
+		owner_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bot models.User
+		err = rows.Scan(&bot.User_id, &bot.Username, &bot.Photo)
+		if err != nil {
+			return nil, err
+		}
+		bot.IsBot = true
+		bots = append(bots, bot)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return bots, nil
+}
+
+// Utils function that checks if the bot exists and belongs to the user
+func (db *appdbimpl) checkBotOwner(owner_id int64, bot_id int64) error {
+	var isOwner bool
+
+	err := db.c.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1
+			FROM Users
+			WHERE user_id = ? AND kind = 'bot' AND owner_id = ?
+		)`, bot_id, owner_id).Scan(&isOwner)
+	if err != nil {
+		return err
+	}
+	if !isOwner {
+		return errors.New(constants.BotNotFound)
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) CreateApiKey(owner_id int64, bot_id int64, name string, key_hash string, scopes []string) (models.ApiKey, error) {
+	var key models.ApiKey
+	current_time := globaltime.Now().Unix()
+
+	err := db.checkBotOwner(owner_id, bot_id)
+	if err != nil {
+		return key, err
+	}
+
+	err = db.c.QueryRow(`
+		INSERT INTO ApiKeys (bot_id, name, key_hash, scopes, created_at)
+		VALUES (?, ?, ?, ?, ?) RETURNING key_id;`,
+		bot_id,
+		name,
+		key_hash,
+		strings.Join(scopes, " "),
+		current_time,
+	).Scan(&key.Key_id)
+	if err != nil {
+		return key, err
+	}
+
+	key.Bot_id = bot_id
+	key.Name = name
+	key.Scopes = scopes
+	key.CreatedAt = current_time
+
+	return key, nil
+}
+
+func (db *appdbimpl) GetApiKeys(owner_id int64, bot_id int64) ([]models.ApiKey, error) {
+	keys := make([]models.ApiKey, 0)
+
+	err := db.checkBotOwner(owner_id, bot_id)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.c.Query(`
+		SELECT key_id, name, scopes, created_at, last_used_at
+		FROM ApiKeys
+		WHERE bot_id = ?`,
+		bot_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key models.ApiKey
+		var scopes string
+
+		err = rows.Scan(&key.Key_id, &key.Name, &scopes, &key.CreatedAt, &key.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		key.Bot_id = bot_id
+		key.Scopes = strings.Fields(scopes)
+
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (db *appdbimpl) GetApiKey(key_hash string) (models.ApiKey, error) {
+	var key models.ApiKey
+	var scopes string
+
+	err := db.c.QueryRow(`
+		SELECT key_id, bot_id, name, scopes, created_at, last_used_at
+		FROM ApiKeys
+		WHERE key_hash = ?`,
+		key_hash,
+	).Scan(&key.Key_id, &key.Bot_id, &key.Name, &scopes, &key.CreatedAt, &key.LastUsedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, errors.New(constants.ApiKeyNotFound)
+	}
+	if err != nil {
+		return key, err
+	}
+	key.Scopes = strings.Fields(scopes)
+
+	return key, nil
+}
+
+func (db *appdbimpl) TouchApiKey(key_id int64) error {
+	_, err := db.c.Exec("UPDATE ApiKeys SET last_used_at = ? WHERE key_id = ?;", globaltime.Now().Unix(), key_id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) RevokeApiKey(owner_id int64, bot_id int64, key_id int64) error {
+	err := db.checkBotOwner(owner_id, bot_id)
+	if err != nil {
+		return err
+	}
+
+	res, err := db.c.Exec("DELETE FROM ApiKeys WHERE bot_id = ? AND key_id = ?;", bot_id, key_id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New(constants.ApiKeyNotFound)
+	}
+
+	return nil
+}
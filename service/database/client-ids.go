@@ -0,0 +1,90 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+// nullableClientId stores a missing client id as NULL, which never conflicts with other rows
+func nullableClientId(client_message_id string) sql.NullString {
+	return sql.NullString{String: client_message_id, Valid: client_message_id != ""}
+}
+
+// checkClientId fails with DuplicateClientMessageId if the user already sent a row of table, Messages or Comments,
+// with client_message_id
+func (db *appdbimpl) checkClientId(table string, user_id int64, client_message_id string) error {
+	if client_message_id == "" {
+		return nil
+	}
+
+	var taken bool
+	err := db.c.QueryRow(`SELECT EXISTS(SELECT 1 FROM "`+table+`" WHERE user_id = ? AND client_message_id = ?)`,
+		user_id, client_message_id).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errors.New(constants.DuplicateClientMessageId)
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) GetClientMessage(user_id int64, client_message_id string) (models.Message, error) {
+	var message models.Message
+	var conversation_id int64
+	var message_id int64
+
+	err := db.c.QueryRow(`SELECT conversation_id, message_id FROM Messages WHERE user_id = ? AND client_message_id = ?`,
+		user_id, client_message_id).Scan(&conversation_id, &message_id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return message, errors.New(constants.MessageNotFound)
+		}
+		return message, err
+	}
+
+	messages, err := db.queryMessages(user_id, conversation_id, " AND m.message_id = ?", message_id)
+	if err != nil {
+		return message, err
+	}
+	if len(messages) == 0 {
+		return message, errors.New(constants.MessageNotFound)
+	}
+
+	return messages[0], nil
+}
+
+func (db *appdbimpl) GetClientComment(user_id int64, client_message_id string) (models.Comment, error) {
+	var comment models.Comment
+
+	err := db.c.QueryRow(`
+		SELECT comment_id, message_id, content, timestamp
+		FROM Comments
+		WHERE user_id = ? AND client_message_id = ?`,
+		user_id, client_message_id).Scan(&comment.Comment_id, &comment.Message_id, &comment.Content, &comment.Timestamp)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return comment, errors.New("comment not found")
+		}
+		return comment, err
+	}
+
+	comment.Sender, err = db.GetUser(user_id)
+	if err != nil {
+		return comment, err
+	}
+	comment.ClientMessageId = client_message_id
+
+	// The retry gets the comment as it was sent, mentions included
+	comments := []models.Comment{comment}
+	err = db.fillCommentMentions(comment.Message_id, comments)
+	if err != nil {
+		return comment, err
+	}
+
+	return comments[0], nil
+}
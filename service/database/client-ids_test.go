@@ -0,0 +1,65 @@
+package database
+
+import "testing"
+
+func TestGetClientCommentHasMentions(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, conversation_id := newTestConversation(t, db)
+
+	message_id := sendText(t, db, alice, conversation_id, "Dinner tonight?")
+
+	sent, err := db.CreateComment(alice, conversation_id, message_id, "😀 @bob are you in?", "comment-1")
+	if err != nil {
+		t.Fatalf("CreateComment: %v", err)
+	}
+	if len(sent.Mentions) != 1 {
+		t.Fatalf("comment sent with %d mentions, want 1", len(sent.Mentions))
+	}
+
+	retried, err := db.GetClientComment(alice, "comment-1")
+	if err != nil {
+		t.Fatalf("GetClientComment: %v", err)
+	}
+	if len(retried.Mentions) != 1 {
+		t.Fatalf("comment of the retry has %d mentions, want 1", len(retried.Mentions))
+	}
+
+	// Offsets count code points, so the emoji before the mention counts as one
+	mention := retried.Mentions[0]
+	if mention.User.User_id != bob || mention.Offset != 2 || mention.Length != 4 {
+		t.Errorf("mention of user %d at %d long %d, want user %d at 2 long 4", mention.User.User_id, mention.Offset, mention.Length, bob)
+	}
+}
+
+func TestReplyToMessageRetryAfterFailure(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, conversation_id := newTestConversation(t, db)
+	original_id := sendText(t, db, bob, conversation_id, "Who's coming tonight?")
+
+	_, err := db.(*appdbimpl).c.Exec(`
+		CREATE TRIGGER fail_inbox BEFORE INSERT ON InboxItems
+		BEGIN SELECT RAISE(ABORT, 'inbox refused'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.ReplyToMessage(alice, conversation_id, original_id, "text", "Me", nil, "reply-1")
+	if err == nil {
+		t.Fatal("ReplyToMessage succeeded although the inbox item couldn't be stored")
+	}
+	if count := countRows(t, db, "Messages"); count != 1 {
+		t.Errorf("%d messages after the failed reply, want only the original", count)
+	}
+
+	_, err = db.(*appdbimpl).c.Exec(`DROP TRIGGER fail_inbox`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.ReplyToMessage(alice, conversation_id, original_id, "text", "Me", nil, "reply-1")
+	if err != nil {
+		t.Fatalf("retry of the failed reply: %v", err)
+	}
+	if count := countRows(t, db, "Receipts"); count != 2 {
+		t.Errorf("%d receipts, want one for each message", count)
+	}
+}
@@ -1,9 +1,11 @@
 package database
 
 import (
+	"database/sql"
 	"errors"
 	"time"
 
+	"github.com/maisto1/WasaText/service/constants"
 	"github.com/maisto1/WasaText/service/models"
 )
 
@@ -11,7 +13,7 @@ func (db *appdbimpl) GetComments(user_id int64, conversation_id int64, message_i
 	comments := make([]models.Comment, 0)
 	var exists bool
 
-	err := db.c.QueryRow(`SELECT EXISTS(SELECT 1 FROM Messages WHERE message_id = ?)`, message_id).Scan(&exists)
+	err := db.c.QueryRow(`SELECT EXISTS(SELECT 1 FROM Messages m WHERE m.message_id = ? AND m.deleted = 0 AND `+notExpiredCondition()+`)`, message_id).Scan(&exists)
 	if err != nil {
 		return nil, err
 	}
@@ -28,7 +30,7 @@ func (db *appdbimpl) GetComments(user_id int64, conversation_id int64, message_i
 	}
 
 	rows, err := db.c.Query(`
-	SELECT user_id,comment_id, content, timestamp
+	SELECT user_id,comment_id, content, timestamp, COALESCE(client_message_id, '')
 	FROM Comments
 	WHERE message_id = ?`,
 		message_id)
@@ -50,6 +52,7 @@ func (db *appdbimpl) GetComments(user_id int64, conversation_id int64, message_i
 			&comment_id,
 			&content,
 			&timestamp,
+			&comment.ClientMessageId,
 		)
 		if err != nil {
 			return nil, err
@@ -63,7 +66,7 @@ func (db *appdbimpl) GetComments(user_id int64, conversation_id int64, message_i
 		comment.Message_id = message_id
 		comment.Timestamp = timestamp
 
-		err = db.c.QueryRow(`SELECT * FROM Users WHERE user_id = ?`, user_id).Scan(&sender.User_id, &sender.Username, &sender.Photo)
+		sender, err = db.GetUser(user_id)
 		if err != nil {
 			return nil, err
 		}
@@ -73,17 +76,27 @@ func (db *appdbimpl) GetComments(user_id int64, conversation_id int64, message_i
 		comments = append(comments, comment)
 	}
 
+	err = db.fillCommentMentions(message_id, comments)
+	if err != nil {
+		return nil, err
+	}
+
 	return comments, nil
 }
 
-func (db *appdbimpl) CreateComment(user_id int64, conversation_id int64, message_id int64, content string) (models.Comment, error) {
+func (db *appdbimpl) CreateComment(user_id int64, conversation_id int64, message_id int64, content string, client_message_id string) (models.Comment, error) {
 	var comment models.Comment
 	var exists bool
 	current_time := time.Now().Unix()
 	var user models.User
 	var comment_id int64
 
-	err := db.c.QueryRow(`SELECT EXISTS(SELECT 1 FROM Messages WHERE message_id = ?)`, message_id).Scan(&exists)
+	err := db.checkClientId("Comments", user_id, client_message_id)
+	if err != nil {
+		return comment, err
+	}
+
+	err = db.c.QueryRow(`SELECT EXISTS(SELECT 1 FROM Messages m WHERE m.message_id = ? AND m.deleted = 0 AND `+notExpiredCondition()+`)`, message_id).Scan(&exists)
 	if err != nil {
 		return comment, err
 	}
@@ -99,20 +112,44 @@ func (db *appdbimpl) CreateComment(user_id int64, conversation_id int64, message
 		return comment, errors.New("user is not a partecipant")
 	}
 
-	err = db.c.QueryRow(`
-		INSERT INTO Comments (message_id,user_id,content,timestamp)
-		VALUES (?,?,?,?)
+	// The comment is stored with its mentions, or not at all
+	tx, err := db.c.Begin()
+	if err != nil {
+		return comment, err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO Comments (message_id,user_id,content,timestamp,client_message_id)
+		VALUES (?,?,?,?,?)
+		ON CONFLICT DO NOTHING
 		RETURNING comment_id`,
 		message_id,
 		user_id,
 		content,
 		current_time,
+		nullableClientId(client_message_id),
 	).Scan(&comment_id)
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = tx.Rollback()
+		return comment, errors.New(constants.DuplicateClientMessageId)
+	}
 	if err != nil {
+		_ = tx.Rollback()
 		return comment, err
 	}
 
-	err = db.c.QueryRow(`SELECT * FROM Users WHERE user_id = ?`, user_id).Scan(&user.User_id, &user.Username, &user.Photo)
+	comment.Mentions, err = db.recordMentions(tx, conversation_id, message_id, comment_id, user_id, content, current_time)
+	if err != nil {
+		_ = tx.Rollback()
+		return comment, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return comment, err
+	}
+
+	user, err = db.GetUser(user_id)
 	if err != nil {
 		return comment, err
 	}
@@ -122,6 +159,7 @@ func (db *appdbimpl) CreateComment(user_id int64, conversation_id int64, message
 	comment.Comment_id = comment_id
 	comment.Sender = user
 	comment.Content = content
+	comment.ClientMessageId = client_message_id
 
 	return comment, nil
 }
@@ -156,5 +194,12 @@ func (db *appdbimpl) DeleteComment(user_id int64, conversation_id int64, comment
 		return err
 	}
 
+	for _, table := range []string{"Mentions", "InboxItems"} {
+		_, err = db.c.Exec(`DELETE FROM "`+table+`" WHERE comment_id = ?;`, comment_id)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
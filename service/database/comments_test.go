@@ -0,0 +1,36 @@
+package database
+
+import "testing"
+
+func TestCreateCommentRetryAfterFailure(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, _, conversation_id := newTestConversation(t, db)
+	message_id := sendText(t, db, alice, conversation_id, "Dinner tonight?")
+
+	_, err := db.(*appdbimpl).c.Exec(`
+		CREATE TRIGGER fail_mention BEFORE INSERT ON Mentions
+		BEGIN SELECT RAISE(ABORT, 'mention refused'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.CreateComment(alice, conversation_id, message_id, "@bob are you in?", "comment-1")
+	if err == nil {
+		t.Fatal("CreateComment succeeded although the mention couldn't be stored")
+	}
+	if count := countRows(t, db, "Comments"); count != 0 {
+		t.Errorf("%d comments left by the failed comment", count)
+	}
+
+	_, err = db.(*appdbimpl).c.Exec(`DROP TRIGGER fail_mention`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comment, err := db.CreateComment(alice, conversation_id, message_id, "@bob are you in?", "comment-1")
+	if err != nil {
+		t.Fatalf("retry of the failed comment: %v", err)
+	}
+	if len(comment.Mentions) != 1 {
+		t.Errorf("comment with %d mentions, want 1", len(comment.Mentions))
+	}
+}
@@ -8,6 +8,29 @@ import (
 )
 
 // Get preview Conversations
+// otherUserTable, a common table expression, lists the other participants of the conversations of the user given
+// twice as argument. The other participant of a private conversation gives it its name and photo.
+const otherUserTable = `OtherUser AS (
+        SELECT
+            p1.conversation_id,
+            u.user_id AS other_user_id,
+            u.username AS other_username,
+            u.profile_photo AS other_photo
+        FROM Partecipants p1
+        JOIN Partecipants p2 ON p1.conversation_id = p2.conversation_id
+        JOIN Users u ON u.user_id = p2.user_id
+        WHERE p1.user_id = ? AND p2.user_id != ?
+    )`
+
+// conversationNameColumns selects the name and photo of the conversation aliased as c, as seen by the user of the
+// OtherUser table aliased as o
+const conversationNameColumns = `
+        CASE 
+            WHEN c.conversation_type = 'private' THEN o.other_username 
+            ELSE COALESCE(c.name, '') 
+        END AS conversation_name,
+        COALESCE(c.conversation_photo, o.other_photo, '') AS conversation_photo`
+
 func (db *appdbimpl) GetPreviewConversations(user_id int64) ([]models.Preview, error) {
 	previews := make([]models.Preview, 0)
 	var exists bool
@@ -19,26 +42,18 @@ func (db *appdbimpl) GetPreviewConversations(user_id int64) ([]models.Preview, e
 		return nil, errors.New("user not found in database")
 	}
 
+	err = db.markDelivered(user_id)
+	if err != nil {
+		return nil, err
+	}
+
 	rows, err := db.c.Query(`
-    WITH OtherUser AS (
-        SELECT
-            p1.conversation_id,
-            u.user_id AS other_user_id,
-            u.username AS other_username,
-            u.profile_photo AS other_photo
-        FROM Partecipants p1
-        JOIN Partecipants p2 ON p1.conversation_id = p2.conversation_id
-        JOIN Users u ON u.user_id = p2.user_id
-        WHERE p1.user_id = ? AND p2.user_id != ?
-    )
+    WITH `+otherUserTable+`
     SELECT
         c.conversation_id,
-        CASE 
-            WHEN c.conversation_type = 'private' THEN o.other_username 
-            ELSE COALESCE(c.name, '') 
-        END AS conversation_name,
-        COALESCE(c.conversation_photo, o.other_photo, '') AS conversation_photo,
-        c.conversation_type
+        `+conversationNameColumns+`,
+        c.conversation_type,
+        c.message_ttl
     FROM Conversations c
     LEFT JOIN OtherUser o ON c.conversation_id = o.conversation_id
     WHERE c.conversation_id IN (
@@ -59,7 +74,7 @@ func (db *appdbimpl) GetPreviewConversations(user_id int64) ([]models.Preview, e
 		var conversationType string
 		var preview models.Preview
 
-		err = rows.Scan(&conversation_id, &name, &photo, &conversationType)
+		err = rows.Scan(&conversation_id, &name, &photo, &conversationType, &preview.MessageTimer)
 		if err != nil {
 			return previews, err
 		}
@@ -72,13 +87,18 @@ func (db *appdbimpl) GetPreviewConversations(user_id int64) ([]models.Preview, e
 		preview.Photo = photo
 		preview.ConversationType = conversationType
 
-		latestMessage, err := db.GetLatestMessage(conversation_id)
+		latestMessage, err := db.GetLatestMessage(user_id, conversation_id)
 		if err != nil {
 			preview.LatestMessage = nil
 		} else {
 			preview.LatestMessage = &latestMessage
 		}
 
+		err = db.getUnread(user_id, &preview)
+		if err != nil {
+			return previews, err
+		}
+
 		previews = append(previews, preview)
 	}
 
@@ -86,29 +106,31 @@ func (db *appdbimpl) GetPreviewConversations(user_id int64) ([]models.Preview, e
 }
 
 // Get latest message in a specific conversation
-func (db *appdbimpl) GetLatestMessage(conversation_id int64) (models.Message, error) {
+func (db *appdbimpl) GetLatestMessage(user_id int64, conversation_id int64) (models.Message, error) {
 	var message models.Message
 	var user models.User
-	var user_id int64
+	var sender_id int64
 
 	err := db.c.QueryRow(`
 		SELECT 
 			m.message_id,
-			m.content,
-			m.media,
+			`+visibleContentColumns+`,
 			m.type,
 			m.timestamp,
-			m.status,
+			`+messageStatusColumn+`,
 			m.isForwarded,
+			m.edited_at,
+			m.deleted,
+			m.expires_at,
 			m.user_id
 		FROM 
 			Messages m
 		WHERE 
-			m.conversation_id = ?
+			m.conversation_id = ? AND `+notHiddenCondition+` AND `+notExpiredCondition()+timelineCondition+`
 		ORDER BY 
-			m.timestamp DESC
+			m.timestamp DESC, m.message_id DESC
 		LIMIT 1;
-	`, conversation_id).Scan(
+	`, conversation_id, user_id).Scan(
 		&message.Message_id,
 		&message.Content,
 		&message.Media,
@@ -116,7 +138,10 @@ func (db *appdbimpl) GetLatestMessage(conversation_id int64) (models.Message, er
 		&message.Timestamp,
 		&message.Status,
 		&message.Forwarded,
-		&user_id,
+		&message.EditedAt,
+		&message.Deleted,
+		&message.ExpiresAt,
+		&sender_id,
 	)
 
 	if err != nil {
@@ -127,7 +152,7 @@ func (db *appdbimpl) GetLatestMessage(conversation_id int64) (models.Message, er
 		}
 	}
 
-	err = db.c.QueryRow(`SELECT * FROM Users WHERE user_id = ?`, user_id).Scan(&user.User_id, &user.Username, &user.Photo)
+	user, err = db.GetUser(sender_id)
 	if err != nil {
 		return message, err
 	}
@@ -175,10 +200,12 @@ func (db *appdbimpl) CreateConversation(user_id int64, name string, typeConv str
 		return 0, err
 	}
 
+	// The creator of a group is its admin
 	_, err = db.c.Exec(
-		`INSERT INTO Partecipants (user_id, conversation_id) VALUES (?, ?);`,
+		`INSERT INTO Partecipants (user_id, conversation_id, is_admin) VALUES (?, ?, ?);`,
 		user_id,
 		conversation_id,
+		typeConv == "group",
 	)
 	if err != nil {
 		return 0, err
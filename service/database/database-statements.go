@@ -1,12 +1,83 @@
 package database
 
+// Indexes are created with IF NOT EXISTS, so they are added to older databases too
+var indexCreationStatements = []string{
+	`CREATE INDEX IF NOT EXISTS "messages_conversation_idx" ON "Messages"("conversation_id", "message_id");`,
+	`CREATE INDEX IF NOT EXISTS "receipts_user_idx" ON "Receipts"("user_id", "delivered_at");`,
+	`CREATE INDEX IF NOT EXISTS "scheduled_messages_send_at_idx" ON "ScheduledMessages"("send_at");`,
+	`CREATE INDEX IF NOT EXISTS "messages_expires_at_idx" ON "Messages"("expires_at") WHERE "expires_at" IS NOT NULL;`,
+	`CREATE INDEX IF NOT EXISTS "messages_deleted_idx" ON "Messages"("deleted_at") WHERE "deleted_at" IS NOT NULL;`,
+	// NULLs are distinct, so only the rows sent with a client id are unique per sender
+	`CREATE UNIQUE INDEX IF NOT EXISTS "messages_client_id_idx" ON "Messages"("user_id", "client_message_id");`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS "comments_client_id_idx" ON "Comments"("user_id", "client_message_id");`,
+	`CREATE INDEX IF NOT EXISTS "messages_thread_idx" ON "Messages"("thread_root_id", "message_id") WHERE "thread_root_id" IS NOT NULL;`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS "inbox_items_entry_idx" ON "InboxItems"("user_id", "message_id", "comment_id");`,
+	`CREATE INDEX IF NOT EXISTS "inbox_items_user_idx" ON "InboxItems"("user_id", "item_id");`,
+	`CREATE INDEX IF NOT EXISTS "poll_options_message_idx" ON "PollOptions"("message_id", "position");`,
+	`CREATE INDEX IF NOT EXISTS "poll_votes_message_idx" ON "PollVotes"("message_id", "user_id");`,
+}
+
+// Full-text search tables, keyed by message_id and comment_id. They are kept in sync by the triggers below, so every
+// write path (edits, deletions, purges, expiry) updates them.
+var searchTablesCreationStatements = map[string]string{
+	"MessagesSearch": `CREATE VIRTUAL TABLE "MessagesSearch" USING fts5("content");`,
+	"CommentsSearch": `CREATE VIRTUAL TABLE "CommentsSearch" USING fts5("content");`,
+}
+
+// searchBackfillStatements index the rows written while the search tables or their triggers didn't exist
+var searchBackfillStatements = map[string]string{
+	"MessagesSearch": `INSERT INTO "MessagesSearch" (rowid, "content")
+		SELECT message_id, content FROM Messages WHERE deleted = 0 AND type != 'system' AND COALESCE(content, '') != '';`,
+	"CommentsSearch": `INSERT INTO "CommentsSearch" (rowid, "content")
+		SELECT comment_id, content FROM Comments WHERE COALESCE(content, '') != '';`,
+}
+
+var searchTriggerCreationStatements = map[string]string{
+	"messages_search_insert": `CREATE TRIGGER IF NOT EXISTS "messages_search_insert" AFTER INSERT ON "Messages"
+	WHEN new.deleted = 0 AND new.type != 'system' AND COALESCE(new.content, '') != ''
+	BEGIN
+		INSERT INTO "MessagesSearch" (rowid, "content") VALUES (new.message_id, new.content);
+	END;`,
+	"messages_search_update": `CREATE TRIGGER IF NOT EXISTS "messages_search_update" AFTER UPDATE OF "content", "deleted" ON "Messages"
+	BEGIN
+		DELETE FROM "MessagesSearch" WHERE rowid = old.message_id;
+		INSERT INTO "MessagesSearch" (rowid, "content")
+		SELECT new.message_id, new.content WHERE new.deleted = 0 AND new.type != 'system' AND COALESCE(new.content, '') != '';
+	END;`,
+	"messages_search_delete": `CREATE TRIGGER IF NOT EXISTS "messages_search_delete" AFTER DELETE ON "Messages"
+	BEGIN
+		DELETE FROM "MessagesSearch" WHERE rowid = old.message_id;
+	END;`,
+	"comments_search_insert": `CREATE TRIGGER IF NOT EXISTS "comments_search_insert" AFTER INSERT ON "Comments"
+	WHEN COALESCE(new.content, '') != ''
+	BEGIN
+		INSERT INTO "CommentsSearch" (rowid, "content") VALUES (new.comment_id, new.content);
+	END;`,
+	"comments_search_update": `CREATE TRIGGER IF NOT EXISTS "comments_search_update" AFTER UPDATE OF "content" ON "Comments"
+	BEGIN
+		DELETE FROM "CommentsSearch" WHERE rowid = old.comment_id;
+		INSERT INTO "CommentsSearch" (rowid, "content")
+		SELECT new.comment_id, new.content WHERE COALESCE(new.content, '') != '';
+	END;`,
+	"comments_search_delete": `CREATE TRIGGER IF NOT EXISTS "comments_search_delete" AFTER DELETE ON "Comments"
+	BEGIN
+		DELETE FROM "CommentsSearch" WHERE rowid = old.comment_id;
+	END;`,
+}
+
 const (
 	usersTableCreationStatement = `
  CREATE TABLE "Users" (
  "user_id" INTEGER NOT NULL UNIQUE,
  "username" TEXT NOT NULL UNIQUE,
  "profile_photo" BLOB,
- PRIMARY KEY("user_id" AUTOINCREMENT)
+ "kind" TEXT NOT NULL DEFAULT 'user' CHECK(kind IN ('user', 'bot')),
+ "owner_id" INTEGER,
+ "active" INTEGER NOT NULL DEFAULT 1,
+ "external_id" TEXT,
+ "provisioned" INTEGER NOT NULL DEFAULT 0,
+ PRIMARY KEY("user_id" AUTOINCREMENT),
+ FOREIGN KEY("owner_id") REFERENCES "Users"("user_id") ON DELETE CASCADE
  );
  `
 	conversationsTableCreationStatement = `
@@ -15,6 +86,7 @@ const (
  "name" TEXT,
  "conversation_photo" BLOB,
  "conversation_type" TEXT CHECK(conversation_type IN ('private', 'group')),
+ "message_ttl" INTEGER NOT NULL DEFAULT 0,
  PRIMARY KEY("conversation_id" AUTOINCREMENT)
  );
  `
@@ -30,10 +102,23 @@ const (
  "status" TEXT,
  "isForwarded" INTEGER,
  "reply_to_id" INTEGER,
+ "edited_at" INTEGER,
+ "deleted" INTEGER NOT NULL DEFAULT 0,
+ "deleted_at" INTEGER,
+ "expires_at" INTEGER,
+ "client_message_id" TEXT,
+ "thread_root_id" INTEGER,
+ "latitude" REAL,
+ "longitude" REAL,
+ "accuracy" REAL,
+ "place_label" TEXT,
+ "location_updated_at" INTEGER,
+ "live_until" INTEGER,
  PRIMARY KEY("message_id" AUTOINCREMENT),
  FOREIGN KEY("conversation_id") REFERENCES "Conversations"("conversation_id") ON DELETE CASCADE,
  FOREIGN KEY("user_id") REFERENCES "Users"("user_id") ON DELETE CASCADE,
- FOREIGN KEY("reply_to_id") REFERENCES "Messages"("message_id") ON DELETE SET NULL
+ FOREIGN KEY("reply_to_id") REFERENCES "Messages"("message_id") ON DELETE SET NULL,
+ FOREIGN KEY("thread_root_id") REFERENCES "Messages"("message_id") ON DELETE SET NULL
  );
  `
 	commentsTableCreationStatement = `
@@ -43,6 +128,7 @@ const (
  "user_id" INTEGER NOT NULL,
  "content" TEXT,
  "timestamp" INTEGER,
+ "client_message_id" TEXT,
  PRIMARY KEY("comment_id" AUTOINCREMENT),
  FOREIGN KEY("message_id") REFERENCES "Messages"("message_id") ON DELETE CASCADE,
  FOREIGN KEY("user_id") REFERENCES "Users"("user_id") ON DELETE CASCADE
@@ -52,9 +138,227 @@ const (
  CREATE TABLE "Partecipants" (
  "user_id" INTEGER NOT NULL,
  "conversation_id" INTEGER NOT NULL,
+ "last_read_id" INTEGER NOT NULL DEFAULT 0,
+ "is_admin" INTEGER NOT NULL DEFAULT 0,
  PRIMARY KEY("user_id", "conversation_id"),
  FOREIGN KEY("user_id") REFERENCES "Users"("user_id") ON DELETE CASCADE,
  FOREIGN KEY("conversation_id") REFERENCES "Conversations"("conversation_id") ON DELETE CASCADE
  );
+ `
+	sessionsTableCreationStatement = `
+ CREATE TABLE "Sessions" (
+ "session_id" INTEGER NOT NULL UNIQUE,
+ "user_id" INTEGER NOT NULL,
+ "token_hash" TEXT NOT NULL UNIQUE,
+ "created_at" INTEGER NOT NULL,
+ "expires_at" INTEGER NOT NULL,
+ "last_used_at" INTEGER,
+ "user_agent" TEXT,
+ "remote_ip" TEXT,
+ PRIMARY KEY("session_id" AUTOINCREMENT),
+ FOREIGN KEY("user_id") REFERENCES "Users"("user_id") ON DELETE CASCADE
+ );
+ `
+	credentialsTableCreationStatement = `
+ CREATE TABLE "Credentials" (
+ "user_id" INTEGER NOT NULL UNIQUE,
+ "password_hash" TEXT NOT NULL,
+ "updated_at" INTEGER NOT NULL,
+ PRIMARY KEY("user_id"),
+ FOREIGN KEY("user_id") REFERENCES "Users"("user_id") ON DELETE CASCADE
+ );
+ `
+	twoFactorTableCreationStatement = `
+ CREATE TABLE "TwoFactor" (
+ "user_id" INTEGER NOT NULL UNIQUE,
+ "secret" TEXT NOT NULL,
+ "enabled" INTEGER NOT NULL DEFAULT 0,
+ "last_step" INTEGER NOT NULL DEFAULT 0,
+ "created_at" INTEGER NOT NULL,
+ PRIMARY KEY("user_id"),
+ FOREIGN KEY("user_id") REFERENCES "Users"("user_id") ON DELETE CASCADE
+ );
+ `
+	recoveryCodesTableCreationStatement = `
+ CREATE TABLE "RecoveryCodes" (
+ "code_id" INTEGER NOT NULL UNIQUE,
+ "user_id" INTEGER NOT NULL,
+ "code_hash" TEXT NOT NULL,
+ "used_at" INTEGER,
+ PRIMARY KEY("code_id" AUTOINCREMENT),
+ FOREIGN KEY("user_id") REFERENCES "Users"("user_id") ON DELETE CASCADE
+ );
+ `
+	apiKeysTableCreationStatement = `
+ CREATE TABLE "ApiKeys" (
+ "key_id" INTEGER NOT NULL UNIQUE,
+ "bot_id" INTEGER NOT NULL,
+ "name" TEXT NOT NULL,
+ "key_hash" TEXT NOT NULL UNIQUE,
+ "scopes" TEXT NOT NULL,
+ "created_at" INTEGER NOT NULL,
+ "last_used_at" INTEGER,
+ PRIMARY KEY("key_id" AUTOINCREMENT),
+ FOREIGN KEY("bot_id") REFERENCES "Users"("user_id") ON DELETE CASCADE
+ );
+ `
+	oidcStatesTableCreationStatement = `
+ CREATE TABLE "OidcStates" (
+ "state" TEXT NOT NULL UNIQUE,
+ "code_verifier" TEXT NOT NULL,
+ "nonce" TEXT NOT NULL,
+ "expires_at" INTEGER NOT NULL,
+ PRIMARY KEY("state")
+ );
+ `
+	identitiesTableCreationStatement = `
+ CREATE TABLE "Identities" (
+ "issuer" TEXT NOT NULL,
+ "subject" TEXT NOT NULL,
+ "user_id" INTEGER NOT NULL,
+ "created_at" INTEGER NOT NULL,
+ PRIMARY KEY("issuer", "subject"),
+ FOREIGN KEY("user_id") REFERENCES "Users"("user_id") ON DELETE CASCADE
+ );
+ `
+	receiptsTableCreationStatement = `
+ CREATE TABLE "Receipts" (
+ "message_id" INTEGER NOT NULL,
+ "user_id" INTEGER NOT NULL,
+ "delivered_at" INTEGER,
+ "read_at" INTEGER,
+ PRIMARY KEY("message_id", "user_id"),
+ FOREIGN KEY("message_id") REFERENCES "Messages"("message_id") ON DELETE CASCADE,
+ FOREIGN KEY("user_id") REFERENCES "Users"("user_id") ON DELETE CASCADE
+ );
+ `
+	messageEditsTableCreationStatement = `
+ CREATE TABLE "MessageEdits" (
+ "edit_id" INTEGER NOT NULL UNIQUE,
+ "message_id" INTEGER NOT NULL,
+ "content" TEXT,
+ "timestamp" INTEGER NOT NULL,
+ PRIMARY KEY("edit_id" AUTOINCREMENT),
+ FOREIGN KEY("message_id") REFERENCES "Messages"("message_id") ON DELETE CASCADE
+ );
+ `
+	hiddenMessagesTableCreationStatement = `
+ CREATE TABLE "HiddenMessages" (
+ "user_id" INTEGER NOT NULL,
+ "message_id" INTEGER NOT NULL,
+ PRIMARY KEY("user_id", "message_id"),
+ FOREIGN KEY("user_id") REFERENCES "Users"("user_id") ON DELETE CASCADE,
+ FOREIGN KEY("message_id") REFERENCES "Messages"("message_id") ON DELETE CASCADE
+ );
+ `
+	scheduledMessagesTableCreationStatement = `
+ CREATE TABLE "ScheduledMessages" (
+ "scheduled_id" INTEGER NOT NULL UNIQUE,
+ "conversation_id" INTEGER NOT NULL,
+ "user_id" INTEGER NOT NULL,
+ "type" TEXT NOT NULL,
+ "content" TEXT,
+ "media" BLOB,
+ "send_at" INTEGER NOT NULL,
+ "created_at" INTEGER NOT NULL,
+ PRIMARY KEY("scheduled_id" AUTOINCREMENT),
+ FOREIGN KEY("conversation_id") REFERENCES "Conversations"("conversation_id") ON DELETE CASCADE,
+ FOREIGN KEY("user_id") REFERENCES "Users"("user_id") ON DELETE CASCADE
+ );
+ `
+	reactionsTableCreationStatement = `
+ CREATE TABLE "Reactions" (
+ "message_id" INTEGER NOT NULL,
+ "user_id" INTEGER NOT NULL,
+ "emoji" TEXT NOT NULL,
+ "timestamp" INTEGER NOT NULL,
+ PRIMARY KEY("message_id", "user_id"),
+ FOREIGN KEY("message_id") REFERENCES "Messages"("message_id") ON DELETE CASCADE,
+ FOREIGN KEY("user_id") REFERENCES "Users"("user_id") ON DELETE CASCADE
+ );
+ `
+	mentionsTableCreationStatement = `
+ CREATE TABLE "Mentions" (
+ "message_id" INTEGER NOT NULL,
+ "comment_id" INTEGER NOT NULL DEFAULT 0,
+ "user_id" INTEGER NOT NULL,
+ "position" INTEGER NOT NULL,
+ "length" INTEGER NOT NULL,
+ PRIMARY KEY("message_id", "comment_id", "position"),
+ FOREIGN KEY("message_id") REFERENCES "Messages"("message_id") ON DELETE CASCADE,
+ FOREIGN KEY("user_id") REFERENCES "Users"("user_id") ON DELETE CASCADE
+ );
+ `
+	inboxItemsTableCreationStatement = `
+ CREATE TABLE "InboxItems" (
+ "item_id" INTEGER NOT NULL UNIQUE,
+ "user_id" INTEGER NOT NULL,
+ "conversation_id" INTEGER NOT NULL,
+ "message_id" INTEGER NOT NULL,
+ "comment_id" INTEGER NOT NULL DEFAULT 0,
+ "kind" TEXT NOT NULL CHECK("kind" IN ('mention', 'reply', 'thread')),
+ "timestamp" INTEGER NOT NULL,
+ "seen" INTEGER NOT NULL DEFAULT 0,
+ PRIMARY KEY("item_id" AUTOINCREMENT),
+ FOREIGN KEY("user_id") REFERENCES "Users"("user_id") ON DELETE CASCADE,
+ FOREIGN KEY("conversation_id") REFERENCES "Conversations"("conversation_id") ON DELETE CASCADE,
+ FOREIGN KEY("message_id") REFERENCES "Messages"("message_id") ON DELETE CASCADE
+ );
+ `
+	pinsTableCreationStatement = `
+ CREATE TABLE "Pins" (
+ "conversation_id" INTEGER NOT NULL,
+ "message_id" INTEGER NOT NULL,
+ "pinned_by" INTEGER NOT NULL,
+ "timestamp" INTEGER NOT NULL,
+ PRIMARY KEY("conversation_id", "message_id"),
+ FOREIGN KEY("conversation_id") REFERENCES "Conversations"("conversation_id") ON DELETE CASCADE,
+ FOREIGN KEY("message_id") REFERENCES "Messages"("message_id") ON DELETE CASCADE
+ );
+ `
+	starsTableCreationStatement = `
+ CREATE TABLE "Stars" (
+ "star_id" INTEGER NOT NULL UNIQUE,
+ "user_id" INTEGER NOT NULL,
+ "message_id" INTEGER NOT NULL,
+ "timestamp" INTEGER NOT NULL,
+ PRIMARY KEY("star_id" AUTOINCREMENT),
+ UNIQUE("user_id", "message_id"),
+ FOREIGN KEY("user_id") REFERENCES "Users"("user_id") ON DELETE CASCADE,
+ FOREIGN KEY("message_id") REFERENCES "Messages"("message_id") ON DELETE CASCADE
+ );
+ `
+	pollsTableCreationStatement = `
+ CREATE TABLE "Polls" (
+ "message_id" INTEGER NOT NULL,
+ "multiple_choice" INTEGER NOT NULL DEFAULT 0,
+ "anonymous" INTEGER NOT NULL DEFAULT 0,
+ "closes_at" INTEGER,
+ "closed_at" INTEGER,
+ PRIMARY KEY("message_id"),
+ FOREIGN KEY("message_id") REFERENCES "Messages"("message_id") ON DELETE CASCADE
+ );
+ `
+	pollOptionsTableCreationStatement = `
+ CREATE TABLE "PollOptions" (
+ "option_id" INTEGER NOT NULL UNIQUE,
+ "message_id" INTEGER NOT NULL,
+ "position" INTEGER NOT NULL,
+ "text" TEXT NOT NULL,
+ PRIMARY KEY("option_id" AUTOINCREMENT),
+ FOREIGN KEY("message_id") REFERENCES "Polls"("message_id") ON DELETE CASCADE
+ );
+ `
+	pollVotesTableCreationStatement = `
+ CREATE TABLE "PollVotes" (
+ "message_id" INTEGER NOT NULL,
+ "option_id" INTEGER NOT NULL,
+ "user_id" INTEGER NOT NULL,
+ "timestamp" INTEGER NOT NULL,
+ PRIMARY KEY("option_id", "user_id"),
+ FOREIGN KEY("message_id") REFERENCES "Polls"("message_id") ON DELETE CASCADE,
+ FOREIGN KEY("option_id") REFERENCES "PollOptions"("option_id") ON DELETE CASCADE,
+ FOREIGN KEY("user_id") REFERENCES "Users"("user_id") ON DELETE CASCADE
+ );
  `
 )
@@ -42,11 +42,72 @@ type AppDatabase interface {
 	// Login or Register
 	Login(username string) (int64, error)
 
+	// Get the password hash of a user, empty if the user didn't set a password
+	GetPasswordHash(user_id int64) (string, error)
+
+	// Set the password hash of a user and revoke every session except the given one
+	SetPassword(user_id int64, password_hash string, session_id int64) error
+
+	// Get the TOTP secret of a user, whether it is confirmed and the time step of the last accepted code
+	GetTotp(user_id int64) (string, bool, int64, error)
+
+	// Start a TOTP enrollment, replacing any unconfirmed secret
+	SetTotpSecret(user_id int64, secret string) error
+
+	// Confirm the TOTP enrollment, replacing the recovery codes
+	EnableTotp(user_id int64, step int64, recovery_hashes []string) error
+
+	// Record the time step of an accepted TOTP code, reporting false if a code of the same or a later step was
+	// accepted before
+	SetTotpStep(user_id int64, step int64) (bool, error)
+
+	// Consume an unused recovery code, reporting whether it was valid
+	UseRecoveryCode(user_id int64, code_hash string) (bool, error)
+
+	// Remove the TOTP second factor and the recovery codes
+	DisableTotp(user_id int64) error
+
+	// Store the PKCE verifier and nonce of a single sign-on login in progress
+	CreateOidcState(state string, code_verifier string, nonce string, expires_at int64) error
+
+	// Consume a single sign-on login in progress, returning its PKCE verifier and nonce
+	ConsumeOidcState(state string) (string, string, error)
+
+	// Get the user linked to an identity of the provider, creating it on first login
+	LoginIdentity(issuer string, subject string, username string) (int64, error)
+
+	// Store a new session for the user, identified by the hash of its token
+	CreateSession(user_id int64, token_hash string, expires_at int64, user_agent string, remote_ip string) (models.Session, error)
+
+	// Resolve a session token hash to its session, failing if it is unknown or expired
+	GetSession(token_hash string) (models.Session, error)
+
+	// Record the last use of a session
+	TouchSession(session_id int64, remote_ip string) error
+
+	// Get the active sessions of a user
+	GetSessions(user_id int64) ([]models.Session, error)
+
+	// Revoke a session
+	DeleteSession(session_id int64) error
+
+	// Revoke a session of a specific user
+	RevokeSession(user_id int64, session_id int64) error
+
+	// Revoke every session of a user
+	RevokeSessions(user_id int64) error
+
+	// Delete the sessions expired before now
+	DeleteExpiredSessions(now int64) (int, error)
+
 	// Get preview conversations
 	GetPreviewConversations(user_id int64) ([]models.Preview, error)
 
-	// Get Latest Conversation Message
-	GetLatestMessage(conversation_id int64) (models.Message, error)
+	// Get Latest Conversation Message, as seen by the user
+	GetLatestMessage(user_id int64, conversation_id int64) (models.Message, error)
+
+	// Move the last read marker of the user in a conversation, marking as read the messages up to it
+	SetLastRead(user_id int64, conversation_id int64, message_id int64) error
 
 	// Create a new conversation
 	CreateConversation(user_id int64, group_name string, typeConv string, partecipant string) (int, error)
@@ -57,17 +118,137 @@ type AppDatabase interface {
 	// Return every messages from a specific conversation
 	GetMessages(user_id int64, conversation_id int64) ([]models.Message, error)
 
+	// Get at most limit messages of a conversation between the before and after cursors (0 means unbounded)
+	GetMessagesPage(user_id int64, conversation_id int64, before int64, after int64, limit int) (models.MessagePage, error)
+
+	// Replace the text of a message sent by the user after not_before, keeping the previous version
+	EditMessage(user_id int64, conversation_id int64, message_id int64, content string, not_before int64) (models.Message, error)
+
+	// Get every version of a message, oldest first
+	GetMessageEdits(user_id int64, conversation_id int64, message_id int64) ([]models.MessageEdit, error)
+
+	// Get the delivery and read receipts of a message
+	GetReceipts(user_id int64, conversation_id int64, message_id int64) ([]models.Receipt, error)
+
+	// Get the message around_id of a conversation with up to limit/2 messages before and after it
+	GetMessagesAround(user_id int64, conversation_id int64, around_id int64, limit int) (models.MessagePage, error)
+
 	// Send a message in a conversation
-	CreateMessage(user_id int64, conversation_id int64, target_id int64, typeMessage string, content string, media []byte, forwarded bool) (models.Message, error)
+	CreateMessage(user_id int64, conversation_id int64, target_id int64, typeMessage string, content string, media []byte, forwarded bool, client_message_id string) (models.Message, error)
 
-	// Delete a message
+	// Delete a message for everyone, leaving a tombstone
 	DeleteMessage(user_id int64, conversation_id int64, message_id int64) error
 
+	// Restore a message deleted by the user after deleted_after
+	RestoreMessage(user_id int64, conversation_id int64, message_id int64, deleted_after int64) error
+
+	// Get the messages deleted by the user after deleted_after, which can still be restored
+	GetTrash(user_id int64, deleted_after int64) ([]models.TrashedMessage, error)
+
+	// Erase the content of the messages deleted before deleted_before, returning how many were purged
+	PurgeDeletedMessages(deleted_before int64) (int, error)
+
+	// Schedule a message to be sent in a conversation at send_at
+	CreateScheduledMessage(user_id int64, conversation_id int64, typeMessage string, content string, media []byte, send_at int64) (models.ScheduledMessage, error)
+
+	// Get the pending scheduled messages of the user in a conversation
+	GetScheduledMessages(user_id int64, conversation_id int64) ([]models.ScheduledMessage, error)
+
+	// Replace a pending scheduled message of the user
+	UpdateScheduledMessage(user_id int64, conversation_id int64, scheduled_id int64, typeMessage string, content string, media []byte, send_at int64) (models.ScheduledMessage, error)
+
+	// Cancel a pending scheduled message of the user
+	DeleteScheduledMessage(user_id int64, conversation_id int64, scheduled_id int64) error
+
+	// Get the scheduled messages due at now, the oldest first, to be sent with SendScheduledMessage
+	GetDueScheduledMessages(now int64) ([]models.ScheduledMessage, error)
+
+	// Send a scheduled message due at now, removing it in the same transaction
+	SendScheduledMessage(scheduled_id int64, now int64) (models.Message, error)
+
+	// Set the disappearing messages timer of a conversation, posting a notice about it
+	SetMessageTimer(user_id int64, conversation_id int64, ttl int64) (models.Message, error)
+
+	// Delete for good the disappearing messages expired at now, returning how many were deleted
+	DeleteExpiredMessages(now int64) (int, error)
+
+	// React to a message with an emoji, replacing the previous reaction of the user
+	SetReaction(user_id int64, conversation_id int64, message_id int64, emoji string) error
+
+	// Remove the reaction of the user to a message
+	DeleteReaction(user_id int64, conversation_id int64, message_id int64) error
+
+	// Get who reacted to a message and with which emoji
+	GetReactions(user_id int64, conversation_id int64, message_id int64) ([]models.Reaction, error)
+
+	// Pin a message of a conversation, unless max_pins are pinned already, posting a notice about it
+	PinMessage(user_id int64, conversation_id int64, message_id int64, max_pins int) (models.Message, error)
+
+	// Unpin a message of a conversation
+	UnpinMessage(user_id int64, conversation_id int64, message_id int64) error
+
+	// Get the pinned messages of a conversation, the last pinned first
+	GetPinnedMessages(user_id int64, conversation_id int64) ([]models.PinnedMessage, error)
+
+	// Star a message for the user, to find it in their starred messages
+	StarMessage(user_id int64, conversation_id int64, message_id int64) error
+
+	// Remove the star of the user from a message
+	UnstarMessage(user_id int64, conversation_id int64, message_id int64) error
+
+	// Get a page of the messages starred by the user, the last starred first
+	GetStarredMessages(user_id int64, before int64, limit int) (models.StarredPage, error)
+
+	// Send a poll in a conversation
+	CreatePoll(user_id int64, conversation_id int64, poll models.PollDraft, client_message_id string) (models.Message, error)
+
+	// Replace the votes of the user in an open poll with option_ids, none to retract them
+	VotePoll(user_id int64, conversation_id int64, message_id int64, option_ids []int64) (models.Message, error)
+
+	// Close a poll sent by the user, freezing its results
+	ClosePoll(user_id int64, conversation_id int64, message_id int64) (models.Message, error)
+
+	// Send a location, or share a live location until its duration passes
+	CreateLocation(user_id int64, conversation_id int64, typeMessage string, location models.LocationDraft, client_message_id string) (models.Message, error)
+
+	// Move a live location shared by the user to a new position
+	UpdateLiveLocation(user_id int64, conversation_id int64, message_id int64, position models.Position) (models.Message, error)
+
+	// Stop sharing a live location before its duration passes
+	StopLiveLocation(user_id int64, conversation_id int64, message_id int64) (models.Message, error)
+
+	// Delete a message only for the user, hiding it
+	HideMessage(user_id int64, conversation_id int64, message_id int64) error
+
+	// Search the messages and comments of the conversations of the user
+	SearchMessages(user_id int64, filter models.SearchFilter) ([]models.SearchHit, error)
+
+	// Tell whether full-text search is available, i.e. SQLite was built with the sqlite_fts5 tag
+	SearchAvailable() bool
+
+	// Get a page of the messages and comments mentioning the user or replying to them, the newest first
+	GetInbox(user_id int64, before int64, limit int, unseen_only bool) (models.InboxPage, error)
+
+	// Mark as seen the items of the inbox of the user up to item_id
+	MarkInboxSeen(user_id int64, item_id int64) error
+
+	// Get the message sent by the user with a client id, to answer retries of its creation
+	GetClientMessage(user_id int64, client_message_id string) (models.Message, error)
+
+	// Get the comment written by the user with a client id, to answer retries of its creation
+	GetClientComment(user_id int64, client_message_id string) (models.Comment, error)
+
 	// Forward a message to another conversation
-	ForwardMessage(user_id int64, conversation_id int64, target_id int64, message_id int64) (models.Message, error)
+	ForwardMessage(user_id int64, conversation_id int64, target_id int64, message_id int64, client_message_id string) (models.Message, error)
+
+	// Reply to a message in its thread, out of the timeline of the conversation
+	CreateThreadReply(user_id int64, conversation_id int64, root_id int64, typeMessage string, content string, media []byte, client_message_id string) (models.Message, error)
+
+	// Get a thread with a page of its replies, as GetMessagesPage
+	GetThread(user_id int64, conversation_id int64, root_id int64, before int64, after int64, limit int) (models.Thread, error)
 
 	// Reply to a conversation message
-	ReplyToMessage(user_id int64, conversation_id int64, reply_to_id int64, typeMessage string, content string, media []byte) (models.Message, error)
+	ReplyToMessage(user_id int64, conversation_id int64, reply_to_id int64, typeMessage string, content string, media []byte, client_message_id string) (models.Message, error)
 
 	// Utils function that checks if user is partecipant in a conversation
 	CheckUserConversation(user_id int64, conversation_id int64) (bool, error)
@@ -76,7 +257,7 @@ type AppDatabase interface {
 	GetComments(user_id int64, conversation_id int64, message_id int64) ([]models.Comment, error)
 
 	// Create a comment under a message
-	CreateComment(user_id int64, conversation_id int64, message_id int64, content string) (models.Comment, error)
+	CreateComment(user_id int64, conversation_id int64, message_id int64, content string, client_message_id string) (models.Comment, error)
 
 	// Delete a comment
 	DeleteComment(user_id int64, conversation_id int64, comment_id int64) error
@@ -96,6 +277,42 @@ type AppDatabase interface {
 	// Get group members
 	GetGroupMembers(conversation_id int64) ([]models.User, error)
 
+	// Create a bot account owned by a user
+	CreateBot(owner_id int64, username string) (models.User, error)
+
+	// Get the bots owned by a user
+	GetBots(owner_id int64) ([]models.User, error)
+
+	// Store a new API key for a bot owned by the user
+	CreateApiKey(owner_id int64, bot_id int64, name string, key_hash string, scopes []string) (models.ApiKey, error)
+
+	// Get the API keys of a bot owned by the user
+	GetApiKeys(owner_id int64, bot_id int64) ([]models.ApiKey, error)
+
+	// Resolve an API key hash to its key
+	GetApiKey(key_hash string) (models.ApiKey, error)
+
+	// Record the last use of an API key
+	TouchApiKey(key_id int64) error
+
+	// Revoke an API key of a bot owned by the user
+	RevokeApiKey(owner_id int64, bot_id int64, key_id int64) error
+
+	// Provision a user from the identity management system
+	CreateAccount(username string, external_id string, active bool) (models.Account, error)
+
+	// Get the provisioning attributes of a user
+	GetAccount(user_id int64) (models.Account, error)
+
+	// List users, optionally filtered by username, external id or active flag, with 1-based pagination
+	GetAccounts(filter models.AccountFilter, start_index int, count int) ([]models.Account, int, error)
+
+	// Update the provisioning attributes of a user. Deactivating a user revokes its sessions and its bots' keys
+	UpdateAccount(user_id int64, username *string, external_id *string, active *bool) (models.Account, error)
+
+	// Get a user by id
+	GetUser(user_id int64) (models.User, error)
+
 	// Edit profile name
 	EditProfileName(user_id int64, username string) error
 
@@ -110,6 +327,15 @@ type AppDatabase interface {
 
 type appdbimpl struct {
 	c *sql.DB
+
+	// search tells whether SQLite was built with full-text search
+	search bool
+}
+
+// execer runs statements on the database or in a transaction, so that the helpers writing part of a change can be
+// used by changes made in a single transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
 }
 
 // New returns a new instance of AppDatabase based on the SQLite connection `db`.
@@ -120,11 +346,30 @@ func New(db *sql.DB) (AppDatabase, error) {
 	}
 
 	TableMapping := map[string]string{
-		"Users":         usersTableCreationStatement,
-		"Conversations": conversationsTableCreationStatement,
-		"Partecipants":  partecipantsTableCreationStatement,
-		"Messages":      messagesTableCreationStatement,
-		"Comments":      commentsTableCreationStatement,
+		"Users":             usersTableCreationStatement,
+		"Conversations":     conversationsTableCreationStatement,
+		"Partecipants":      partecipantsTableCreationStatement,
+		"Messages":          messagesTableCreationStatement,
+		"Comments":          commentsTableCreationStatement,
+		"Sessions":          sessionsTableCreationStatement,
+		"Credentials":       credentialsTableCreationStatement,
+		"TwoFactor":         twoFactorTableCreationStatement,
+		"RecoveryCodes":     recoveryCodesTableCreationStatement,
+		"ApiKeys":           apiKeysTableCreationStatement,
+		"OidcStates":        oidcStatesTableCreationStatement,
+		"Identities":        identitiesTableCreationStatement,
+		"Receipts":          receiptsTableCreationStatement,
+		"MessageEdits":      messageEditsTableCreationStatement,
+		"HiddenMessages":    hiddenMessagesTableCreationStatement,
+		"ScheduledMessages": scheduledMessagesTableCreationStatement,
+		"Reactions":         reactionsTableCreationStatement,
+		"Mentions":          mentionsTableCreationStatement,
+		"InboxItems":        inboxItemsTableCreationStatement,
+		"Pins":              pinsTableCreationStatement,
+		"Stars":             starsTableCreationStatement,
+		"Polls":             pollsTableCreationStatement,
+		"PollOptions":       pollOptionsTableCreationStatement,
+		"PollVotes":         pollVotesTableCreationStatement,
 	}
 
 	for tableName, tableCreationStatement := range TableMapping {
@@ -142,6 +387,61 @@ func New(db *sql.DB) (AppDatabase, error) {
 		}
 	}
 
+	// Columns added to a table after its first release: databases created before get them with ALTER TABLE
+	ColumnMigrations := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"Users", "kind", "TEXT NOT NULL DEFAULT 'user' CHECK(kind IN ('user', 'bot'))"},
+		{"Users", "owner_id", "INTEGER REFERENCES Users(user_id) ON DELETE CASCADE"},
+		{"Users", "active", "INTEGER NOT NULL DEFAULT 1"},
+		{"Users", "external_id", "TEXT"},
+		{"Users", "provisioned", "INTEGER NOT NULL DEFAULT 0"},
+		{"Partecipants", "last_read_id", "INTEGER NOT NULL DEFAULT 0"},
+		{"Messages", "edited_at", "INTEGER"},
+		{"Messages", "deleted", "INTEGER NOT NULL DEFAULT 0"},
+		{"Messages", "deleted_at", "INTEGER"},
+		{"Messages", "expires_at", "INTEGER"},
+		{"Conversations", "message_ttl", "INTEGER NOT NULL DEFAULT 0"},
+		{"Partecipants", "is_admin", "INTEGER NOT NULL DEFAULT 0"},
+		{"Messages", "client_message_id", "TEXT"},
+		{"Comments", "client_message_id", "TEXT"},
+		{"Messages", "thread_root_id", "INTEGER REFERENCES Messages(message_id) ON DELETE SET NULL"},
+		{"Messages", "latitude", "REAL"},
+		{"Messages", "longitude", "REAL"},
+		{"Messages", "accuracy", "REAL"},
+		{"Messages", "place_label", "TEXT"},
+		{"Messages", "location_updated_at", "INTEGER"},
+		{"Messages", "live_until", "INTEGER"},
+	}
+
+	for _, migration := range ColumnMigrations {
+		var exists bool
+		err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM pragma_table_info(?) WHERE name = ?);`, migration.table, migration.column).Scan(&exists)
+		if err != nil {
+			return nil, errors.New("error checking column " + migration.table + "." + migration.column)
+		}
+		if !exists {
+			_, err = db.Exec(`ALTER TABLE "` + migration.table + `" ADD COLUMN "` + migration.column + `" ` + migration.definition + `;`)
+			if err != nil {
+				return nil, errors.New("error adding column " + migration.table + "." + migration.column)
+			}
+		}
+	}
+
+	for _, indexCreationStatement := range indexCreationStatements {
+		_, err := db.Exec(indexCreationStatement)
+		if err != nil {
+			return nil, errors.New("error building index: " + indexCreationStatement)
+		}
+	}
+
+	search, err := setupSearch(db)
+	if err != nil {
+		return nil, err
+	}
+
 	// query := `
 	// 	INSERT INTO Users (username, profile_photo) VALUES
 	// 	('user1', NULL),
@@ -191,7 +491,8 @@ func New(db *sql.DB) (AppDatabase, error) {
 	// fmt.Println("Database popolato con successo!")
 
 	return &appdbimpl{
-		c: db,
+		c:      db,
+		search: search,
 	}, nil
 }
 
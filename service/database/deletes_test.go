@@ -0,0 +1,86 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/maisto1/WasaText/service/models"
+)
+
+// findMessage returns the message among the messages of the conversation seen by user_id, or nil
+func findMessage(t *testing.T, db AppDatabase, user_id int64, conversation_id int64, message_id int64) *models.Message {
+	t.Helper()
+
+	messages, err := db.GetMessages(user_id, conversation_id)
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	for i := range messages {
+		if messages[i].Message_id == message_id {
+			return &messages[i]
+		}
+	}
+	return nil
+}
+
+func TestDeleteMessageForEveryone(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, conversation_id := newTestConversation(t, db)
+
+	message_id := sendText(t, db, alice, conversation_id, "Oops, wrong chat")
+	reply, err := db.ReplyToMessage(bob, conversation_id, message_id, "text", "What?", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.DeleteMessage(bob, conversation_id, message_id)
+	if err == nil {
+		t.Error("bob deleted a message of alice for everyone")
+	}
+	err = db.DeleteMessage(alice, conversation_id, message_id)
+	if err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+
+	// Everyone sees the tombstone in its place, without its content, and the reply quotes it as deleted
+	for _, user_id := range []int64{alice, bob} {
+		tombstone := findMessage(t, db, user_id, conversation_id, message_id)
+		if tombstone == nil || !tombstone.Deleted || tombstone.Content != "" || tombstone.Media != nil {
+			t.Errorf("user %d sees %+v, want a tombstone", user_id, tombstone)
+		}
+
+		quoting := findMessage(t, db, user_id, conversation_id, reply.Message_id)
+		if quoting == nil || quoting.ReplyTo == nil {
+			t.Fatalf("user %d doesn't see the reply quoting the tombstone", user_id)
+		}
+		if quote := *quoting.ReplyTo; !quote.Deleted || quote.Content != "Message deleted." || quote.Sender != "alice" {
+			t.Errorf("user %d sees the reply quoting %+v, want the tombstone of alice", user_id, quote)
+		}
+	}
+}
+
+func TestHideMessage(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, conversation_id := newTestConversation(t, db)
+
+	first := sendText(t, db, alice, conversation_id, "first")
+	second := sendText(t, db, alice, conversation_id, "second")
+
+	err := db.HideMessage(bob, conversation_id, second)
+	if err != nil {
+		t.Fatalf("HideMessage: %v", err)
+	}
+
+	if findMessage(t, db, bob, conversation_id, second) != nil {
+		t.Error("the message deleted for bob is still shown to bob")
+	}
+	if findMessage(t, db, alice, conversation_id, second) == nil {
+		t.Error("the message deleted for bob only is gone for alice")
+	}
+
+	// Pages skip it without breaking the cursors
+	page, err := db.GetMessagesPage(bob, conversation_id, 0, 0, 1)
+	if err != nil {
+		t.Fatalf("GetMessagesPage: %v", err)
+	}
+	checkPage(t, "page without the hidden message", page, []int64{first}, 0, 0)
+}
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+func (db *appdbimpl) EditMessage(user_id int64, conversation_id int64, message_id int64, content string, not_before int64) (models.Message, error) {
+	var message models.Message
+
+	isValid, err := db.CheckUserConversation(user_id, conversation_id)
+	if err != nil {
+		return message, err
+	}
+	if !isValid {
+		return message, errors.New("user is not a partecipant")
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return message, err
+	}
+
+	var sender_id int64
+	var typeMessage string
+	var previous string
+	var sent_at int64
+	var written_at int64
+
+	err = tx.QueryRow(`
+		SELECT user_id, type, COALESCE(content, ''), timestamp, COALESCE(edited_at, timestamp)
+		FROM Messages m
+		WHERE m.message_id = ? AND m.conversation_id = ? AND m.deleted = 0 AND `+notExpiredCondition(),
+		message_id, conversation_id).Scan(&sender_id, &typeMessage, &previous, &sent_at, &written_at)
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return message, errors.New(constants.MessageNotFound)
+		}
+		return message, err
+	}
+
+	if sender_id != user_id {
+		_ = tx.Rollback()
+		return message, errors.New(constants.NotMessageSender)
+	}
+	if typeMessage != "text" {
+		_ = tx.Rollback()
+		return message, errors.New(constants.NotTextMessage)
+	}
+
+	if sent_at < not_before {
+		_ = tx.Rollback()
+		return message, errors.New(constants.EditWindowExpired)
+	}
+
+	_, err = tx.Exec(`INSERT INTO MessageEdits (message_id, content, timestamp) VALUES (?, ?, ?)`,
+		message_id, previous, written_at)
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	edited_at := globaltime.Now().Unix()
+	_, err = tx.Exec(`UPDATE Messages SET content = ?, edited_at = ? WHERE message_id = ?`,
+		content, edited_at, message_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return message, err
+	}
+
+	// Users mentioned only by the new text get it in their inbox as of the edit
+	_, err = db.recordMentions(db.c, conversation_id, message_id, 0, user_id, content, edited_at)
+	if err != nil {
+		return message, err
+	}
+
+	messages, err := db.queryMessages(user_id, conversation_id, " AND m.message_id = ?", message_id)
+	if err != nil {
+		return message, err
+	}
+	if len(messages) == 0 {
+		return message, errors.New(constants.MessageNotFound)
+	}
+
+	return messages[0], nil
+}
+
+func (db *appdbimpl) GetMessageEdits(user_id int64, conversation_id int64, message_id int64) ([]models.MessageEdit, error) {
+	edits := make([]models.MessageEdit, 0)
+
+	isValid, err := db.CheckUserConversation(user_id, conversation_id)
+	if err != nil {
+		return edits, err
+	}
+	if !isValid {
+		return edits, errors.New("user is not a partecipant")
+	}
+
+	var current models.MessageEdit
+	err = db.c.QueryRow(`
+		SELECT COALESCE(content, ''), COALESCE(edited_at, timestamp)
+		FROM Messages m
+		WHERE m.message_id = ? AND m.conversation_id = ? AND m.deleted = 0 AND `+notExpiredCondition(),
+		message_id, conversation_id).Scan(&current.Content, &current.Timestamp)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return edits, errors.New(constants.MessageNotFound)
+		}
+		return edits, err
+	}
+
+	rows, err := db.c.Query(`
+		SELECT COALESCE(content, ''), timestamp
+		FROM MessageEdits
+		WHERE message_id = ?
+		ORDER BY edit_id`, message_id)
+	if err != nil {
+		return edits, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var edit models.MessageEdit
+
+		err = rows.Scan(&edit.Content, &edit.Timestamp)
+		if err != nil {
+			return edits, err
+		}
+
+		edits = append(edits, edit)
+	}
+	if rows.Err() != nil {
+		return edits, rows.Err()
+	}
+
+	return append(edits, current), nil
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/maisto1/WasaText/service/constants"
+)
+
+func TestEditMessage(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, conversation_id := newTestConversation(t, db)
+
+	setTime(t, 1700000000)
+	message_id := sendText(t, db, alice, conversation_id, "See you at 8")
+	reply, err := db.ReplyToMessage(bob, conversation_id, message_id, "text", "Great", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setTime(t, 1700000060)
+	edited, err := db.EditMessage(alice, conversation_id, message_id, "See you at 9", 1700000000)
+	if err != nil {
+		t.Fatalf("EditMessage: %v", err)
+	}
+	if edited.Content != "See you at 9" || edited.EditedAt == nil || *edited.EditedAt != 1700000060 {
+		t.Errorf("edited message %q edited at %v", edited.Content, edited.EditedAt)
+	}
+
+	setTime(t, 1700000120)
+	_, err = db.EditMessage(alice, conversation_id, message_id, "See you at 10", 1700000000)
+	if err != nil {
+		t.Fatalf("EditMessage: %v", err)
+	}
+
+	edits, err := db.GetMessageEdits(bob, conversation_id, message_id)
+	if err != nil {
+		t.Fatalf("GetMessageEdits: %v", err)
+	}
+	want := []struct {
+		content   string
+		timestamp int64
+	}{{"See you at 8", 1700000000}, {"See you at 9", 1700000060}, {"See you at 10", 1700000120}}
+	if len(edits) != len(want) {
+		t.Fatalf("%d versions, want %d", len(edits), len(want))
+	}
+	for i := range want {
+		if edits[i].Content != want[i].content || edits[i].Timestamp != want[i].timestamp {
+			t.Errorf("version %d: %q at %d, want %q at %d", i, edits[i].Content, edits[i].Timestamp, want[i].content, want[i].timestamp)
+		}
+	}
+
+	// The quote in the reply shows the current text
+	messages, err := db.(*appdbimpl).queryMessages(bob, conversation_id, " AND m.message_id = ?", reply.Message_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].ReplyTo == nil || messages[0].ReplyTo.Content != "See you at 10" {
+		t.Errorf("reply quotes %+v, want the current text", messages[0].ReplyTo)
+	}
+}
+
+func TestEditMessageRefusals(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, conversation_id := newTestConversation(t, db)
+
+	setTime(t, 1700000000)
+	message_id := sendText(t, db, alice, conversation_id, "See you at 8")
+
+	cases := []struct {
+		name       string
+		user_id    int64
+		not_before int64
+		want       string
+	}{
+		{"edit by another user", bob, 1700000000, constants.NotMessageSender},
+		{"edit past the window", alice, 1700000001, constants.EditWindowExpired},
+	}
+	for _, c := range cases {
+		_, err := db.EditMessage(c.user_id, conversation_id, message_id, "See you at 9", c.not_before)
+		if err == nil || err.Error() != c.want {
+			t.Errorf("%s: %v, want %s", c.name, err, c.want)
+		}
+	}
+
+	err := db.DeleteMessage(alice, conversation_id, message_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.EditMessage(alice, conversation_id, message_id, "See you at 9", 0)
+	if err == nil || err.Error() != constants.MessageNotFound {
+		t.Errorf("edit of a deleted message: %v, want %s", err, constants.MessageNotFound)
+	}
+
+	if count := countRows(t, db, "MessageEdits"); count != 0 {
+		t.Errorf("%d versions stored by the refused edits", count)
+	}
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"database/sql"
 	"errors"
 
 	"github.com/maisto1/WasaText/service/models"
@@ -59,6 +60,16 @@ func (db *appdbimpl) RemoveGroup(user_id int64, conversation_id int64, member_id
 	if err != nil {
 		return err
 	}
+
+	// Messages the member won't read anymore must not hold back the status of the others
+	_, err = db.c.Exec(`
+		DELETE FROM Receipts
+		WHERE user_id = ? AND read_at IS NULL AND message_id IN (
+			SELECT message_id FROM Messages WHERE conversation_id = ?
+		)`, member_id, conversation_id)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -124,7 +135,7 @@ func (db *appdbimpl) GetGroupMembers(conversation_id int64) ([]models.User, erro
 	}
 
 	rows, err := db.c.Query(`
-        SELECT u.user_id, u.username, u.profile_photo
+        SELECT u.user_id, u.username, u.profile_photo, u.kind = 'bot'
         FROM Users u
         JOIN Partecipants p ON u.user_id = p.user_id
         WHERE p.conversation_id = ?
@@ -137,7 +148,7 @@ func (db *appdbimpl) GetGroupMembers(conversation_id int64) ([]models.User, erro
 	var members []models.User
 	for rows.Next() {
 		var user models.User
-		err := rows.Scan(&user.User_id, &user.Username, &user.Photo)
+		err := rows.Scan(&user.User_id, &user.Username, &user.Photo, &user.IsBot)
 		if err != nil {
 			return nil, err
 		}
@@ -154,3 +165,27 @@ func (db *appdbimpl) GetGroupMembers(conversation_id int64) ([]models.User, erro
 
 	return members, nil
 }
+
+// canManageConversation tells whether the user can change the settings of the conversation: any participant of a
+// private conversation, only the admins of a group, or any member of a group without admins (e.g. created before
+// admins existed, or left by all of them)
+func (db *appdbimpl) canManageConversation(user_id int64, conversation_id int64) (bool, error) {
+	var canManage bool
+
+	err := db.c.QueryRow(`
+		SELECT p.is_admin = 1 OR c.conversation_type = 'private' OR NOT EXISTS (
+			SELECT 1 FROM Partecipants a WHERE a.conversation_id = p.conversation_id AND a.is_admin = 1
+		)
+		FROM Partecipants p
+		JOIN Conversations c ON c.conversation_id = p.conversation_id
+		WHERE p.user_id = ? AND p.conversation_id = ?`,
+		user_id, conversation_id).Scan(&canManage)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, errors.New("user is not a partecipant")
+		}
+		return false, err
+	}
+
+	return canManage, nil
+}
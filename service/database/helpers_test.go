@@ -0,0 +1,94 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/maisto1/WasaText/service/globaltime"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestDatabase opens a new database in a temporary file, closed at the end of the test
+func newTestDatabase(t *testing.T) AppDatabase {
+	dbconn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("opening SQLite: %v", err)
+	}
+	t.Cleanup(func() { _ = dbconn.Close() })
+
+	db, err := New(dbconn)
+	if err != nil {
+		t.Fatalf("creating the database: %v", err)
+	}
+	return db
+}
+
+// newTestConversation returns two users and their private conversation
+func newTestConversation(t *testing.T, db AppDatabase) (int64, int64, int64) {
+	alice, err := db.Login("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := db.Login("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conversation_id, err := db.CreateConversation(alice, "", "private", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return alice, bob, int64(conversation_id)
+}
+
+// newTestGroup returns three users and their group, created by the first one. Like in the application, the creator
+// adds the others through private conversations with them.
+func newTestGroup(t *testing.T, db AppDatabase) (int64, int64, int64, int64) {
+	alice, bob, _ := newTestConversation(t, db)
+	carol, err := db.Login("carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateConversation(alice, "", "private", "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group_id, err := db.CreateConversation(alice, "Team", "group", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, username := range []string{"bob", "carol"} {
+		err = db.AddGroup(alice, username, int64(group_id))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return alice, bob, carol, int64(group_id)
+}
+
+// countRows returns how many rows table has
+func countRows(t *testing.T, db AppDatabase, table string) int {
+	var count int
+	err := db.(*appdbimpl).c.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+// setTime fixes the current time at unix until the end of the test
+func setTime(t *testing.T, unix int64) {
+	globaltime.FixedTime = time.Unix(unix, 0)
+	t.Cleanup(func() { globaltime.FixedTime = time.Time{} })
+}
+
+// sendText sends a text message, failing the test on error
+func sendText(t *testing.T, db AppDatabase, user_id int64, conversation_id int64, content string) int64 {
+	message, err := db.CreateMessage(user_id, conversation_id, 0, "text", content, nil, false, "")
+	if err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+	return message.Message_id
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+)
+
+func (db *appdbimpl) CreateOidcState(state string, code_verifier string, nonce string, expires_at int64) error {
+	// Logins never completed are cleaned up here, to keep the table small
+	_, err := db.c.Exec("DELETE FROM OidcStates WHERE expires_at <= ?;", globaltime.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	_, err = db.c.Exec(`
+		INSERT INTO OidcStates (state, code_verifier, nonce, expires_at) VALUES (?, ?, ?, ?);`,
+		state, code_verifier, nonce, expires_at)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) ConsumeOidcState(state string) (string, string, error) {
+	var code_verifier string
+	var nonce string
+
+	err := db.c.QueryRow(`
+		DELETE FROM OidcStates WHERE state = ? AND expires_at > ?
+		RETURNING code_verifier, nonce;`,
+		state, globaltime.Now().Unix(),
+	).Scan(&code_verifier, &nonce)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", errors.New(constants.OidcStateNotFound)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	return code_verifier, nonce, nil
+}
+
+// On first login the identity is linked to the account provisioned through SCIM with the subject as external id, if
+// any. It is never linked to an existing account with the same username, as the username isn't verified: the new user
+// takes the first free variant of the username, adding a number at the end.
+func (db *appdbimpl) LoginIdentity(issuer string, subject string, username string) (int64, error) {
+	var user_id int64
+	var active bool
+
+	err := db.c.QueryRow(`
+		SELECT i.user_id, u.active
+		FROM Identities i
+		JOIN Users u ON u.user_id = i.user_id
+		WHERE i.issuer = ? AND i.subject = ?;`,
+		issuer, subject).Scan(&user_id, &active)
+	if err == nil {
+		if !active {
+			return 0, errors.New(constants.UserDeactivated)
+		}
+		return user_id, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	// An account linked to another identity already has its own way to log in
+	err = tx.QueryRow(`
+		SELECT u.user_id, u.active
+		FROM Users u
+		WHERE u.external_id = ? AND u.kind = 'user'
+		AND NOT EXISTS (SELECT 1 FROM Identities i WHERE i.user_id = u.user_id);`,
+		subject).Scan(&user_id, &active)
+	if err == nil {
+		if !active {
+			_ = tx.Rollback()
+			return 0, errors.New(constants.UserDeactivated)
+		}
+		return user_id, linkIdentity(tx, issuer, subject, user_id)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	candidate := username
+	for i := 1; ; i++ {
+		var exists bool
+		err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM Users WHERE username = ?)", candidate).Scan(&exists)
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+		if !exists {
+			break
+		}
+
+		suffix := strconv.Itoa(i)
+		candidate = TruncateUsername(username, constants.MaxUsernameLength-len(suffix)) + suffix
+	}
+
+	err = tx.QueryRow(`INSERT INTO Users (username) VALUES (?) RETURNING user_id;`, candidate).Scan(&user_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	return user_id, linkIdentity(tx, issuer, subject, user_id)
+}
+
+// linkIdentity links the identity to the user and commits tx
+func linkIdentity(tx *sql.Tx, issuer string, subject string, user_id int64) error {
+	_, err := tx.Exec(`
+		INSERT INTO Identities (issuer, subject, user_id, created_at) VALUES (?, ?, ?, ?);`,
+		issuer, subject, user_id, globaltime.Now().Unix())
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// TruncateUsername shortens username to at most max bytes, without splitting a character
+func TruncateUsername(username string, max int) string {
+	for len(username) > max {
+		_, size := utf8.DecodeLastRuneInString(username)
+		username = username[:len(username)-size]
+	}
+	return username
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/maisto1/WasaText/service/constants"
+)
+
+func TestLoginIdentityTakesAFreeUsername(t *testing.T) {
+	db := newTestDatabase(t)
+
+	// 16 bytes, 8 characters of 2 bytes each
+	username := "àèìòùàèì"
+	_, err := db.Login(username)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user_id, err := db.LoginIdentity("https://idp.example.com", "1234", username)
+	if err != nil {
+		t.Fatalf("LoginIdentity: %v", err)
+	}
+
+	user, err := db.GetUser(user_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "àèìòùàè1" {
+		t.Errorf("new user named %q, want %q", user.Username, "àèìòùàè1")
+	}
+	if !utf8.ValidString(user.Username) || len(user.Username) > constants.MaxUsernameLength {
+		t.Errorf("username %q is not valid", user.Username)
+	}
+
+	// The same identity logs in as the same user
+	again, err := db.LoginIdentity("https://idp.example.com", "1234", username)
+	if err != nil || again != user_id {
+		t.Errorf("second login as user %d (%v), want %d", again, err, user_id)
+	}
+}
+
+func TestLoginIdentityLinksProvisionedAccount(t *testing.T) {
+	db := newTestDatabase(t)
+
+	account, err := db.CreateAccount("alice", "00u1a2b3c4", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user_id, err := db.LoginIdentity("https://idp.example.com", "00u1a2b3c4", "alice")
+	if err != nil {
+		t.Fatalf("LoginIdentity: %v", err)
+	}
+	if user_id != account.User_id {
+		t.Errorf("provisioned user signed in as user %d, want %d", user_id, account.User_id)
+	}
+
+	// Another subject with the same username isn't linked to the account
+	other, err := db.LoginIdentity("https://idp.example.com", "5678", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == account.User_id {
+		t.Errorf("another subject was linked to the provisioned user")
+	}
+}
+
+func TestLoginIdentityRefusesDeactivatedProvisionedAccount(t *testing.T) {
+	db := newTestDatabase(t)
+
+	_, err := db.CreateAccount("alice", "00u1a2b3c4", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.LoginIdentity("https://idp.example.com", "00u1a2b3c4", "alice")
+	if err == nil || err.Error() != constants.UserDeactivated {
+		t.Errorf("LoginIdentity of a deactivated account returned %v, want %q", err, constants.UserDeactivated)
+	}
+}
+
+func TestTruncateUsername(t *testing.T) {
+	cases := []struct {
+		username string
+		max      int
+		want     string
+	}{
+		{"maria", 16, "maria"},
+		{"mariagraziarossi", 10, "mariagrazi"},
+		{"josé", 4, "jos"},
+		{"日本語", 7, "日本"},
+	}
+
+	for _, c := range cases {
+		if got := TruncateUsername(c.username, c.max); got != c.want {
+			t.Errorf("TruncateUsername(%q, %d) = %q, want %q", c.username, c.max, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+// inboxVisibleCondition keeps the inbox items aliased as i whose message, aliased as m, and comment the user given as
+// argument can still see, in a conversation they are still in
+const inboxVisibleCondition = `
+	EXISTS (SELECT 1 FROM Partecipants p WHERE p.conversation_id = i.conversation_id AND p.user_id = i.user_id)
+	AND (i.comment_id = 0 OR EXISTS (SELECT 1 FROM Comments c WHERE c.comment_id = i.comment_id))
+	AND m.deleted = 0 AND ` + notHiddenCondition
+
+// addInboxItem adds a message, or its comment comment_id when it isn't 0, to the inbox of the user. A message already
+// in the inbox keeps its first item, so a reply mentioning the user appears once.
+func addInboxItem(ex execer, user_id int64, conversation_id int64, message_id int64, comment_id int64, kind string, timestamp int64) error {
+	_, err := ex.Exec(`
+		INSERT OR IGNORE INTO InboxItems (user_id, conversation_id, message_id, comment_id, kind, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		user_id, conversation_id, message_id, comment_id, kind, timestamp)
+	return err
+}
+
+func (db *appdbimpl) GetInbox(user_id int64, before int64, limit int, unseen_only bool) (models.InboxPage, error) {
+	page := models.InboxPage{Items: make([]models.InboxItem, 0)}
+
+	filter := ""
+	args := []interface{}{user_id, user_id}
+	if before > 0 {
+		filter += " AND i.item_id < ?"
+		args = append(args, before)
+	}
+	if unseen_only {
+		filter += " AND i.seen = 0"
+	}
+
+	// One more item than requested tells whether there is an older page
+	rows, err := db.c.Query(`
+		SELECT i.item_id, i.kind, i.conversation_id, i.message_id, i.comment_id, i.timestamp, i.seen
+		FROM InboxItems i
+		JOIN Messages m ON m.message_id = i.message_id
+		WHERE i.user_id = ? AND `+inboxVisibleCondition+` AND `+notExpiredCondition()+filter+`
+		ORDER BY i.item_id DESC
+		LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		return page, err
+	}
+
+	var comment_ids []int64
+	for rows.Next() {
+		var item models.InboxItem
+		var comment_id int64
+
+		err = rows.Scan(&item.Item_id, &item.Kind, &item.Conversation_id, &item.Message.Message_id, &comment_id, &item.Timestamp, &item.Seen)
+		if err != nil {
+			rows.Close()
+			return page, err
+		}
+
+		page.Items = append(page.Items, item)
+		comment_ids = append(comment_ids, comment_id)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return page, rows.Err()
+	}
+
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		page.OlderCursor = &page.Items[limit-1].Item_id
+	}
+
+	for i := range page.Items {
+		item := &page.Items[i]
+
+		messages, err := db.queryMessages(user_id, item.Conversation_id, " AND m.message_id = ?", item.Message.Message_id)
+		if err != nil {
+			return page, err
+		}
+		if len(messages) == 0 {
+			return page, errors.New(constants.MessageNotFound)
+		}
+		item.Message = messages[0]
+
+		if comment_ids[i] != 0 {
+			comment, err := db.getComment(item.Message.Message_id, comment_ids[i])
+			if err != nil {
+				return page, err
+			}
+			item.Comment = &comment
+		}
+	}
+
+	err = db.c.QueryRow(`
+		SELECT COUNT(*)
+		FROM InboxItems i
+		JOIN Messages m ON m.message_id = i.message_id
+		WHERE i.user_id = ? AND i.seen = 0 AND `+inboxVisibleCondition+` AND `+notExpiredCondition(),
+		user_id, user_id).Scan(&page.UnseenCount)
+	if err != nil {
+		return page, err
+	}
+
+	return page, nil
+}
+
+func (db *appdbimpl) MarkInboxSeen(user_id int64, item_id int64) error {
+	var exists bool
+	err := db.c.QueryRow(`SELECT EXISTS(SELECT 1 FROM InboxItems WHERE item_id = ? AND user_id = ?)`, item_id, user_id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New(constants.InboxItemNotFound)
+	}
+
+	_, err = db.c.Exec(`UPDATE InboxItems SET seen = 1 WHERE user_id = ? AND item_id <= ? AND seen = 0`, user_id, item_id)
+	return err
+}
+
+// getComment loads a comment under message_id, with its mentions
+func (db *appdbimpl) getComment(message_id int64, comment_id int64) (models.Comment, error) {
+	var comment models.Comment
+	var sender_id int64
+
+	err := db.c.QueryRow(`
+		SELECT user_id, content, timestamp, COALESCE(client_message_id, '')
+		FROM Comments
+		WHERE comment_id = ? AND message_id = ?`,
+		comment_id, message_id).Scan(&sender_id, &comment.Content, &comment.Timestamp, &comment.ClientMessageId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return comment, errors.New(constants.MessageNotFound)
+		}
+		return comment, err
+	}
+
+	comment.Comment_id = comment_id
+	comment.Message_id = message_id
+
+	comment.Sender, err = db.GetUser(sender_id)
+	if err != nil {
+		comment.Sender.User_id = sender_id
+		comment.Sender.Username = "User"
+	}
+
+	comments := []models.Comment{comment}
+	err = db.fillCommentMentions(message_id, comments)
+	if err != nil {
+		return comment, err
+	}
+
+	return comments[0], nil
+}
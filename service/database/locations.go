@@ -0,0 +1,152 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+func (db *appdbimpl) CreateLocation(user_id int64, conversation_id int64, typeMessage string, location models.LocationDraft, client_message_id string) (models.Message, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	message, err := db.insertMessage(tx, user_id, conversation_id, 0, typeMessage, "", nil, false, client_message_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	// Live locations are shared from the moment they are sent
+	var live_until *int64
+	if typeMessage == "live_location" {
+		until := message.Timestamp + location.Duration
+		live_until = &until
+	}
+
+	var label *string
+	if location.Label != "" {
+		label = &location.Label
+	}
+
+	// As for polls, a location message without its place would be empty, so both are stored together
+	_, err = tx.Exec(`
+		UPDATE Messages
+		SET latitude = ?, longitude = ?, accuracy = ?, place_label = ?, location_updated_at = ?, live_until = ?
+		WHERE message_id = ?`,
+		*location.Latitude, *location.Longitude, location.Accuracy, label, message.Timestamp, live_until, message.Message_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return message, err
+	}
+
+	return db.getMessage(user_id, conversation_id, message.Message_id)
+}
+
+// checkLiveLocation checks that message_id is a live location sent by user_id which is still shared
+func (db *appdbimpl) checkLiveLocation(user_id int64, conversation_id int64, message_id int64) error {
+	err := db.checkVisibleMessage(user_id, conversation_id, message_id)
+	if err != nil {
+		return err
+	}
+
+	var sender_id int64
+	var typeMessage string
+	var live_until *int64
+	err = db.c.QueryRow(`SELECT user_id, type, live_until FROM Messages WHERE message_id = ?`, message_id).Scan(
+		&sender_id, &typeMessage, &live_until)
+	if err != nil {
+		return err
+	}
+	if typeMessage != "live_location" {
+		return errors.New(constants.NotLiveLocation)
+	}
+	if sender_id != user_id {
+		return errors.New(constants.NotMessageSender)
+	}
+	if live_until == nil || *live_until <= globaltime.Now().Unix() {
+		return errors.New(constants.LiveLocationEnded)
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) UpdateLiveLocation(user_id int64, conversation_id int64, message_id int64, position models.Position) (models.Message, error) {
+	err := db.checkLiveLocation(user_id, conversation_id, message_id)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	// The sharing may end between the check and the update, then the position is left as it was
+	now := globaltime.Now().Unix()
+	result, err := db.c.Exec(`
+		UPDATE Messages
+		SET latitude = ?, longitude = ?, accuracy = ?, location_updated_at = ?
+		WHERE message_id = ? AND live_until > ?`,
+		position.Latitude, position.Longitude, position.Accuracy, now, message_id, now)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	err = checkLocationUpdated(result)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	return db.getMessage(user_id, conversation_id, message_id)
+}
+
+func (db *appdbimpl) StopLiveLocation(user_id int64, conversation_id int64, message_id int64) (models.Message, error) {
+	err := db.checkLiveLocation(user_id, conversation_id, message_id)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	// The last position stays in the message, it just isn't live anymore
+	now := globaltime.Now().Unix()
+	result, err := db.c.Exec(`UPDATE Messages SET live_until = ? WHERE message_id = ? AND live_until > ?`,
+		now, message_id, now)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	err = checkLocationUpdated(result)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	return db.getMessage(user_id, conversation_id, message_id)
+}
+
+// checkLocationUpdated tells LiveLocationEnded if the update of a live location changed nothing
+func checkLocationUpdated(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New(constants.LiveLocationEnded)
+	}
+
+	return nil
+}
+
+// copyLocation gives the message message_id the place of the location message source_id
+func copyLocation(tx *sql.Tx, source_id int64, message_id int64) error {
+	_, err := tx.Exec(`
+		UPDATE Messages
+		SET (latitude, longitude, accuracy, place_label, location_updated_at) = (
+			SELECT latitude, longitude, accuracy, place_label, location_updated_at FROM Messages WHERE message_id = ?
+		)
+		WHERE message_id = ?`, source_id, message_id)
+	return err
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/maisto1/WasaText/service/models"
+)
+
+func TestCreateLocation(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, _, conversation_id := newTestConversation(t, db)
+
+	latitude, longitude := 41.9, 12.5
+	message, err := db.CreateLocation(alice, conversation_id, "live_location", models.LocationDraft{
+		Latitude:  &latitude,
+		Longitude: &longitude,
+		Label:     "Colosseo",
+		Duration:  900,
+	}, "")
+	if err != nil {
+		t.Fatalf("CreateLocation: %v", err)
+	}
+	if message.Location == nil || message.Location.Label != "Colosseo" || !message.Location.Live {
+		t.Fatalf("CreateLocation returned location %+v, want a live location at Colosseo", message.Location)
+	}
+	if *message.Location.LiveUntil != message.Timestamp+900 {
+		t.Errorf("live until %d, want %d", *message.Location.LiveUntil, message.Timestamp+900)
+	}
+}
+
+func TestForwardLocation(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, _, conversation_id := newTestConversation(t, db)
+	_, err := db.Login("carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target_id, err := db.CreateConversation(alice, "", "private", "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latitude, longitude := 41.9, 12.5
+	message, err := db.CreateLocation(alice, conversation_id, "location", models.LocationDraft{
+		Latitude:  &latitude,
+		Longitude: &longitude,
+		Label:     "Colosseo",
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forwarded, err := db.ForwardMessage(alice, conversation_id, int64(target_id), message.Message_id, "")
+	if err != nil {
+		t.Fatalf("ForwardMessage: %v", err)
+	}
+	if forwarded.Location == nil || forwarded.Location.Label != "Colosseo" || forwarded.Location.Latitude != latitude {
+		t.Errorf("forwarded location %+v, want the place of the original", forwarded.Location)
+	}
+}
+
+func TestCreateLocationStoresNothingOnFailure(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, _, conversation_id := newTestConversation(t, db)
+
+	_, err := db.(*appdbimpl).c.Exec(`
+		CREATE TRIGGER fail_place BEFORE UPDATE OF latitude ON Messages
+		BEGIN SELECT RAISE(ABORT, 'place refused'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latitude, longitude := 41.9, 12.5
+	_, err = db.CreateLocation(alice, conversation_id, "location", models.LocationDraft{
+		Latitude:  &latitude,
+		Longitude: &longitude,
+	}, "")
+	if err == nil {
+		t.Fatal("CreateLocation succeeded although the place couldn't be stored")
+	}
+
+	for _, table := range []string{"Messages", "Receipts"} {
+		if count := countRows(t, db, table); count != 0 {
+			t.Errorf("%d rows left in %s by the failed location", count, table)
+		}
+	}
+}
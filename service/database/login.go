@@ -3,14 +3,27 @@ package database
 import (
 	"database/sql"
 	"errors"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
 )
 
-// If the user exist return userId, otherwise create a new user and return new userID
+// If the user exist return userId, otherwise create a new user and return new userID. Users created through the single
+// sign-on or provisioned through SCIM can log in with the username only once they set a password, which the caller
+// checks.
 func (db *appdbimpl) Login(username string) (int64, error) {
 	var user_id int64
+	var kind string
+	var active bool
+	var external bool
 
 	// Search user in database
-	err := db.c.QueryRow("SELECT user_id FROM Users WHERE username = ?;", username).Scan(&user_id)
+	err := db.c.QueryRow(`
+		SELECT u.user_id, u.kind, u.active,
+		       (u.provisioned = 1 OR u.external_id IS NOT NULL OR EXISTS (SELECT 1 FROM Identities i WHERE i.user_id = u.user_id))
+		       AND NOT EXISTS (SELECT 1 FROM Credentials c WHERE c.user_id = u.user_id)
+		FROM Users u
+		WHERE u.username = ?;`, username).Scan(&user_id, &kind, &active, &external)
 	if errors.Is(err, sql.ErrNoRows) {
 		err := db.c.QueryRow(`INSERT INTO users (username) VALUES (?) RETURNING user_id;`, username).Scan(&user_id)
 		if err != nil {
@@ -18,7 +31,54 @@ func (db *appdbimpl) Login(username string) (int64, error) {
 		}
 		return user_id, nil
 	} else if err == nil {
+		if kind == "bot" {
+			return 0, errors.New(constants.BotAccount)
+		}
+		if !active {
+			return 0, errors.New(constants.UserDeactivated)
+		}
+		if external {
+			return 0, errors.New(constants.ExternalAccount)
+		}
 		return user_id, nil
 	}
 	return 0, err
 }
+
+func (db *appdbimpl) GetPasswordHash(user_id int64) (string, error) {
+	var password_hash string
+
+	err := db.c.QueryRow("SELECT password_hash FROM Credentials WHERE user_id = ?;", user_id).Scan(&password_hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return password_hash, nil
+}
+
+func (db *appdbimpl) SetPassword(user_id int64, password_hash string, session_id int64) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO Credentials (user_id, password_hash, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET password_hash = excluded.password_hash, updated_at = excluded.updated_at;`,
+		user_id, password_hash, globaltime.Now().Unix())
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM Sessions WHERE user_id = ? AND session_id != ?;", user_id, session_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
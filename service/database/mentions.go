@@ -0,0 +1,218 @@
+package database
+
+import (
+	"unicode"
+
+	"github.com/maisto1/WasaText/service/models"
+)
+
+// isMentionBoundary tells whether r can't be part of a word, so that a mention may start or end next to it
+func isMentionBoundary(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+}
+
+// matchUsername returns the length of username if text starts with it, ignoring case, otherwise 0. exact tells whether
+// the case matches too.
+func matchUsername(text []rune, username string) (length int, exact bool) {
+	exact = true
+	for _, r := range username {
+		if length >= len(text) || unicode.ToLower(text[length]) != unicode.ToLower(r) {
+			return 0, false
+		}
+		if text[length] != r {
+			exact = false
+		}
+		length++
+	}
+
+	if length < len(text) && !isMentionBoundary(text[length]) {
+		return 0, false
+	}
+
+	return length, exact
+}
+
+// parseMentions finds the @username of the participants in content. A mention starts at the beginning of the text or
+// after a character which isn't part of a word, so e-mail addresses aren't mentions, and ends with the username.
+// Usernames may contain spaces and punctuation, so the longest matching username wins, preferring the same case.
+func parseMentions(content string, participants []models.User) []models.Mention {
+	var mentions []models.Mention
+
+	text := []rune(content)
+	for i := 0; i < len(text); i++ {
+		if text[i] != '@' || (i > 0 && !isMentionBoundary(text[i-1])) {
+			continue
+		}
+
+		var mention models.Mention
+		var mentionExact bool
+		for _, participant := range participants {
+			length, exact := matchUsername(text[i+1:], participant.Username)
+			if length == 0 || length < mention.Length-1 || (length == mention.Length-1 && (mentionExact || !exact)) {
+				continue
+			}
+			mention = models.Mention{User: participant, Offset: i, Length: length + 1}
+			mentionExact = exact
+		}
+
+		if mention.Length > 0 {
+			mentions = append(mentions, mention)
+			i += mention.Length - 1
+		}
+	}
+
+	return mentions
+}
+
+// getParticipants returns the users in a conversation
+func (db *appdbimpl) getParticipants(conversation_id int64) ([]models.User, error) {
+	rows, err := db.c.Query(`
+		SELECT u.user_id, u.username, u.profile_photo, u.kind = 'bot'
+		FROM Users u
+		JOIN Partecipants p ON u.user_id = p.user_id
+		WHERE p.conversation_id = ?`, conversation_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var participants []models.User
+	for rows.Next() {
+		var user models.User
+		err = rows.Scan(&user.User_id, &user.Username, &user.Photo, &user.IsBot)
+		if err != nil {
+			return nil, err
+		}
+		participants = append(participants, user)
+	}
+
+	return participants, rows.Err()
+}
+
+// recordMentions stores the mentions in the text of a message, or of its comment comment_id when it isn't 0, replacing
+// those of a previous version of the text, and keeps the inbox of the mentioned users up to date. The sender doesn't
+// get its own mentions in the inbox.
+func (db *appdbimpl) recordMentions(ex execer, conversation_id int64, message_id int64, comment_id int64, sender_id int64, content string, timestamp int64) ([]models.Mention, error) {
+	participants, err := db.getParticipants(conversation_id)
+	if err != nil {
+		return nil, err
+	}
+	mentions := parseMentions(content, participants)
+
+	_, err = ex.Exec(`DELETE FROM Mentions WHERE message_id = ? AND comment_id = ?`, message_id, comment_id)
+	if err != nil {
+		return nil, err
+	}
+
+	mentioned := make([]interface{}, 0, len(mentions))
+	for _, mention := range mentions {
+		_, err = ex.Exec(`INSERT INTO Mentions (message_id, comment_id, user_id, position, length) VALUES (?, ?, ?, ?, ?)`,
+			message_id, comment_id, mention.User.User_id, mention.Offset, mention.Length)
+		if err != nil {
+			return nil, err
+		}
+		if mention.User.User_id != sender_id {
+			mentioned = append(mentioned, mention.User.User_id)
+		}
+	}
+
+	// Users no longer mentioned by an edited text leave the inbox, those still mentioned keep their item as it is
+	args := append([]interface{}{message_id, comment_id}, mentioned...)
+	_, err = ex.Exec(`
+		DELETE FROM InboxItems
+		WHERE message_id = ? AND comment_id = ? AND kind = 'mention' AND user_id NOT IN (`+placeholderList(len(mentioned))+`)`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user_id := range mentioned {
+		err = addInboxItem(ex, user_id.(int64), conversation_id, message_id, comment_id, "mention", timestamp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return mentions, nil
+}
+
+// fillMentions sets the mentions in the text of the messages. Deleted messages show no mentions.
+func (db *appdbimpl) fillMentions(messages []models.Message) error {
+	positions := make(map[int64]int, len(messages))
+	message_ids := make([]interface{}, 0, len(messages))
+
+	for i := range messages {
+		if messages[i].Deleted {
+			continue
+		}
+		positions[messages[i].Message_id] = i
+		message_ids = append(message_ids, messages[i].Message_id)
+	}
+
+	return forEachBatch(message_ids, func(placeholders string, batch []interface{}) error {
+		rows, err := db.c.Query(`
+			SELECT message_id, user_id, position, length
+			FROM Mentions
+			WHERE message_id IN (`+placeholders+`) AND comment_id = 0
+			ORDER BY message_id, position`, batch...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var message_id int64
+			var mention models.Mention
+
+			err = rows.Scan(&message_id, &mention.User.User_id, &mention.Offset, &mention.Length)
+			if err != nil {
+				return err
+			}
+
+			mention.User = db.userOrPlaceholder(mention.User.User_id)
+
+			i := positions[message_id]
+			messages[i].Mentions = append(messages[i].Mentions, mention)
+		}
+
+		return rows.Err()
+	})
+}
+
+// fillCommentMentions sets the mentions in the text of the comments under message_id
+func (db *appdbimpl) fillCommentMentions(message_id int64, comments []models.Comment) error {
+	positions := make(map[int64]int, len(comments))
+	for i := range comments {
+		positions[comments[i].Comment_id] = i
+	}
+
+	rows, err := db.c.Query(`
+		SELECT comment_id, user_id, position, length
+		FROM Mentions
+		WHERE message_id = ? AND comment_id != 0
+		ORDER BY comment_id, position`, message_id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var comment_id int64
+		var mention models.Mention
+
+		err = rows.Scan(&comment_id, &mention.User.User_id, &mention.Offset, &mention.Length)
+		if err != nil {
+			return err
+		}
+
+		i, ok := positions[comment_id]
+		if !ok {
+			continue
+		}
+
+		mention.User = db.userOrPlaceholder(mention.User.User_id)
+		comments[i].Mentions = append(comments[i].Mentions, mention)
+	}
+
+	return rows.Err()
+}
@@ -1,9 +1,11 @@
 package database
 
 import (
+	"database/sql"
 	"errors"
-	"time"
 
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
 	"github.com/maisto1/WasaText/service/models"
 )
 
@@ -22,39 +24,220 @@ func (db *appdbimpl) CheckUserConversation(user_id int64, conversation_id int64)
 	}
 
 	if !isParticipant {
-		return false, errors.New("user is not part of the conversation")
+		return false, errors.New(constants.NotPartecipant)
 	}
 
 	return true, nil
 }
 
 func (db *appdbimpl) GetMessages(user_id int64, conversation_id int64) ([]models.Message, error) {
-	messages := make([]models.Message, 0)
+	isValid, err := db.CheckUserConversation(user_id, conversation_id)
+	if err != nil {
+		return make([]models.Message, 0), err
+	}
+	if !isValid {
+		return make([]models.Message, 0), errors.New("user is not a partecipant")
+	}
 
+	return db.readMessages(user_id, conversation_id, timelineCondition)
+}
+
+func (db *appdbimpl) GetMessagesPage(user_id int64, conversation_id int64, before int64, after int64, limit int) (models.MessagePage, error) {
 	isValid, err := db.CheckUserConversation(user_id, conversation_id)
 	if err != nil {
-		return messages, err
+		return models.MessagePage{}, err
 	}
 	if !isValid {
-		return messages, errors.New("user is not a partecipant")
+		return models.MessagePage{}, errors.New("user is not a partecipant")
+	}
+
+	return db.readPage(user_id, conversation_id, timelineCondition, nil, before, after, limit)
+}
+
+// readPage loads a page of the messages of a conversation in scope, a condition like timelineCondition with its
+// scope_args, as GetMessagesPage
+func (db *appdbimpl) readPage(user_id int64, conversation_id int64, scope string, scope_args []interface{}, before int64, after int64, limit int) (models.MessagePage, error) {
+	var page models.MessagePage
+	var messages []models.Message
+	var err error
+
+	filter := scope
+	args := append(make([]interface{}, 0, len(scope_args)+3), scope_args...)
+	if before > 0 {
+		filter += " AND m.message_id < ?"
+		args = append(args, before)
+	}
+	if after > 0 {
+		filter += " AND m.message_id > ?"
+		args = append(args, after)
+	}
+
+	// Walking forward from a cursor the oldest messages come first, otherwise the newest ones
+	if after > 0 && before == 0 {
+		messages, err = db.readMessages(user_id, conversation_id, filter+" ORDER BY m.message_id ASC LIMIT ?", append(args, limit)...)
+		if err != nil {
+			return page, err
+		}
+	} else {
+		messages, err = db.readMessages(user_id, conversation_id, filter+" ORDER BY m.message_id DESC LIMIT ?", append(args, limit)...)
+		if err != nil {
+			return page, err
+		}
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+
+	page.Messages = messages
+	if len(messages) == 0 {
+		return page, nil
+	}
+
+	page.OlderCursor, err = db.messageCursor(user_id, conversation_id, scope, scope_args, messages[0].Message_id, "<")
+	if err != nil {
+		return page, err
+	}
+	page.NewerCursor, err = db.messageCursor(user_id, conversation_id, scope, scope_args, messages[len(messages)-1].Message_id, ">")
+	if err != nil {
+		return page, err
+	}
+
+	return page, nil
+}
+
+func (db *appdbimpl) GetMessagesAround(user_id int64, conversation_id int64, around_id int64, limit int) (models.MessagePage, error) {
+	var page models.MessagePage
+
+	isValid, err := db.CheckUserConversation(user_id, conversation_id)
+	if err != nil {
+		return page, err
+	}
+	if !isValid {
+		return page, errors.New("user is not a partecipant")
+	}
+
+	var exists bool
+	err = db.c.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1
+			FROM Messages m
+			WHERE m.conversation_id = ? AND m.message_id = ? `+timelineCondition+`
+		)`, conversation_id, around_id).Scan(&exists)
+	if err != nil {
+		return page, err
+	}
+	if !exists {
+		return page, errors.New(constants.MessageNotFound)
+	}
+
+	older, err := db.readMessages(user_id, conversation_id, timelineCondition+" AND m.message_id < ? ORDER BY m.message_id DESC LIMIT ?", around_id, limit/2)
+	if err != nil {
+		return page, err
+	}
+
+	// The anchor comes first in the newer half
+	newer, err := db.readMessages(user_id, conversation_id, timelineCondition+" AND m.message_id >= ? ORDER BY m.message_id ASC LIMIT ?", around_id, limit/2+1)
+	if err != nil {
+		return page, err
+	}
+
+	messages := make([]models.Message, 0, len(older)+len(newer))
+	for i := len(older) - 1; i >= 0; i-- {
+		messages = append(messages, older[i])
+	}
+	page.Messages = append(messages, newer...)
+
+	page.OlderCursor, err = db.messageCursor(user_id, conversation_id, timelineCondition, nil, page.Messages[0].Message_id, "<")
+	if err != nil {
+		return page, err
+	}
+	page.NewerCursor, err = db.messageCursor(user_id, conversation_id, timelineCondition, nil, page.Messages[len(page.Messages)-1].Message_id, ">")
+	if err != nil {
+		return page, err
+	}
+
+	return page, nil
+}
+
+// messageCursor returns message_id if the conversation has messages in scope visible to the user past it in the
+// direction given by the operator
+func (db *appdbimpl) messageCursor(user_id int64, conversation_id int64, scope string, scope_args []interface{}, message_id int64, operator string) (*int64, error) {
+	var exists bool
+
+	args := append([]interface{}{conversation_id, message_id, user_id}, scope_args...)
+	err := db.c.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1
+			FROM Messages m
+			WHERE m.conversation_id = ? AND m.message_id `+operator+` ? AND `+notHiddenCondition+` AND `+notExpiredCondition()+scope+`
+		)`, args...).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	return &message_id, nil
+}
+
+// visibleContentColumns selects content and media of the message aliased as m, empty while it is deleted
+const visibleContentColumns = `
+	CASE WHEN m.deleted = 1 THEN '' ELSE m.content END,
+	CASE WHEN m.deleted = 1 THEN NULL ELSE m.media END`
+
+// notHiddenCondition excludes the messages aliased as m deleted only for the user given as argument
+const notHiddenCondition = `NOT EXISTS (SELECT 1 FROM HiddenMessages h WHERE h.message_id = m.message_id AND h.user_id = ?)`
+
+// timelineCondition, appended to a filter, excludes the replies in threads from the messages aliased as m
+const timelineCondition = ` AND m.thread_root_id IS NULL`
+
+// getMessage loads a message of the conversation as seen by user_id, like queryMessages
+func (db *appdbimpl) getMessage(user_id int64, conversation_id int64, message_id int64) (models.Message, error) {
+	messages, err := db.queryMessages(user_id, conversation_id, " AND m.message_id = ?", message_id)
+	if err != nil {
+		return models.Message{}, err
+	}
+	if len(messages) == 0 {
+		return models.Message{}, errors.New(constants.MessageNotFound)
+	}
+
+	return messages[0], nil
+}
+
+// readMessages loads the messages of a conversation matching filter as queryMessages, marking as read those received
+// by user_id
+func (db *appdbimpl) readMessages(user_id int64, conversation_id int64, filter string, args ...interface{}) ([]models.Message, error) {
+	err := db.markRead(user_id, conversation_id, filter, args...)
+	if err != nil {
+		return nil, err
 	}
 
+	return db.queryMessages(user_id, conversation_id, filter, args...)
+}
+
+// queryMessages loads the messages of a conversation matching filter, appended to the WHERE clause with its args, as
+// seen by user_id
+func (db *appdbimpl) queryMessages(user_id int64, conversation_id int64, filter string, args ...interface{}) ([]models.Message, error) {
+	messages := make([]models.Message, 0)
+
 	rows, err := db.c.Query(`
-        SELECT m.message_id, m.timestamp, m.user_id, m.type, m.content, m.media, m.status, m.isForwarded, m.reply_to_id,
+        SELECT m.message_id, m.timestamp, m.user_id, m.type, `+visibleContentColumns+`, `+messageStatusColumn+`, m.isForwarded, m.reply_to_id, m.edited_at, m.deleted, m.expires_at,
+               COALESCE(m.client_message_id, ''), m.thread_root_id,
+               m.latitude, m.longitude, m.accuracy, COALESCE(m.place_label, ''), m.location_updated_at, m.live_until,
                CASE WHEN r.message_id IS NULL THEN NULL ELSE r.content END as reply_content,
-               CASE WHEN r.message_id IS NULL THEN NULL ELSE u_reply.username END as reply_sender
+               CASE WHEN r.message_id IS NULL THEN NULL ELSE u_reply.username END as reply_sender,
+               CASE WHEN r.expires_at <= ? THEN 1 ELSE COALESCE(r.deleted, 1) END as reply_deleted
         FROM Messages m
         LEFT JOIN Messages r ON m.reply_to_id = r.message_id
         LEFT JOIN Users u_reply ON r.user_id = u_reply.user_id
-        WHERE m.conversation_id = ?
-    `, conversation_id)
+        WHERE m.conversation_id = ? AND `+notHiddenCondition+` AND `+notExpiredCondition()+` `+filter,
+		append([]interface{}{globaltime.Now().Unix(), conversation_id, user_id}, args...)...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var messagesToUpdate []int64
-
 	for rows.Next() {
 		var message_id int64
 		var timestamp int64
@@ -69,6 +252,16 @@ func (db *appdbimpl) GetMessages(user_id int64, conversation_id int64) ([]models
 		var reply_to_id *int64
 		var reply_content *string
 		var reply_sender *string
+		var edited_at *int64
+		var deleted bool
+		var expires_at *int64
+		var client_message_id string
+		var thread_root_id *int64
+		var latitude *float64
+		var longitude *float64
+		var location_updated_at *int64
+		var location models.Location
+		var reply_deleted bool
 
 		err = rows.Scan(
 			&message_id,
@@ -80,8 +273,20 @@ func (db *appdbimpl) GetMessages(user_id int64, conversation_id int64) ([]models
 			&status,
 			&forwarded,
 			&reply_to_id,
+			&edited_at,
+			&deleted,
+			&expires_at,
+			&client_message_id,
+			&thread_root_id,
+			&latitude,
+			&longitude,
+			&location.Accuracy,
+			&location.Label,
+			&location_updated_at,
+			&location.LiveUntil,
 			&reply_content,
 			&reply_sender,
+			&reply_deleted,
 		)
 		if err != nil {
 			return messages, err
@@ -94,24 +299,42 @@ func (db *appdbimpl) GetMessages(user_id int64, conversation_id int64) ([]models
 		message.Media = media
 		message.Status = status
 		message.Forwarded = forwarded
+		message.EditedAt = edited_at
+		message.Deleted = deleted
+		message.ExpiresAt = expires_at
+		message.ClientMessageId = client_message_id
+		message.ThreadRootId = thread_root_id
+
+		if latitude != nil && longitude != nil && location_updated_at != nil && !deleted {
+			location.Latitude = *latitude
+			location.Longitude = *longitude
+			location.UpdatedAt = *location_updated_at
+			location.Live = typeMedia == "live_location" && location.LiveUntil != nil && *location.LiveUntil > globaltime.Now().Unix()
+			message.Location = &location
+		}
 
 		if reply_to_id != nil && *reply_to_id > 0 {
-			if reply_content != nil && reply_sender != nil {
+			if reply_content != nil && reply_sender != nil && !reply_deleted {
 				message.ReplyTo = &models.ReplyInfo{
 					ID:      *reply_to_id,
 					Content: *reply_content,
 					Sender:  *reply_sender,
 				}
 			} else {
+				// Tombstones keep their sender, messages removed before tombstones existed don't
 				message.ReplyTo = &models.ReplyInfo{
 					ID:      *reply_to_id,
 					Content: "Message deleted.",
 					Sender:  "User",
+					Deleted: true,
+				}
+				if reply_sender != nil {
+					message.ReplyTo.Sender = *reply_sender
 				}
 			}
 		}
 
-		err = db.c.QueryRow(`SELECT * FROM Users WHERE user_id = ?`, sender_id).Scan(&sender.User_id, &sender.Username, &sender.Photo)
+		sender, err = db.GetUser(sender_id)
 		if err != nil {
 			sender.User_id = sender_id
 			sender.Username = "User"
@@ -119,78 +342,85 @@ func (db *appdbimpl) GetMessages(user_id int64, conversation_id int64) ([]models
 		}
 		message.Sender = sender
 		messages = append(messages, message)
-
-		if sender_id != user_id && status == "sent" {
-			messagesToUpdate = append(messagesToUpdate, message_id)
-		}
 	}
 
 	if rows.Err() != nil {
 		return nil, rows.Err()
 	}
 
-	if len(messagesToUpdate) > 0 {
-		tx, err := db.c.Begin()
-		if err != nil {
-			return messages, err
-		}
-		stmt, err := tx.Prepare(`UPDATE Messages SET status = 'read' WHERE message_id = ?`)
-		if err != nil {
-			rollbackErr := tx.Rollback()
-			if rollbackErr != nil {
-				return messages, err
-			}
-			return messages, err
-		}
-		defer stmt.Close()
-
-		for _, mid := range messagesToUpdate {
-			_, err := stmt.Exec(mid)
-			if err != nil {
-				rollbackErr := tx.Rollback()
-				if rollbackErr != nil {
-					return messages, err
-				}
-				return messages, err
-			}
-			for i := range messages {
-				if messages[i].Message_id == mid {
-					messages[i].Status = "read"
-				}
-			}
-		}
+	err = db.fillMentions(messages)
+	if err != nil {
+		return nil, err
+	}
 
-		err = tx.Commit()
-		if err != nil {
-			return messages, err
-		}
+	err = db.fillReactions(user_id, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.fillThreads(user_id, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.fillPolls(user_id, messages)
+	if err != nil {
+		return nil, err
 	}
 
 	return messages, nil
 }
 
-func (db *appdbimpl) CreateMessage(user_id int64, conversation_id int64, target_id int64, typeMessage string, content string, media []byte, forwarded bool) (models.Message, error) {
+func (db *appdbimpl) CreateMessage(user_id int64, conversation_id int64, target_id int64, typeMessage string, content string, media []byte, forwarded bool, client_message_id string) (models.Message, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	message, err := db.insertMessage(tx, user_id, conversation_id, target_id, typeMessage, content, media, forwarded, client_message_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	return message, tx.Commit()
+}
+
+// insertMessage sends a message in the transaction tx, which messages made of more than a row, like polls, complete
+// before committing
+func (db *appdbimpl) insertMessage(tx *sql.Tx, user_id int64, conversation_id int64, target_id int64, typeMessage string, content string, media []byte, forwarded bool, client_message_id string) (models.Message, error) {
 	var message_id int64
 	var message models.Message
 	var user models.User
 
-	current_time := time.Now().Unix()
+	current_time := globaltime.Now().Unix()
 
 	isValid, err := db.CheckUserConversation(user_id, conversation_id)
 	if err != nil {
 		return message, err
 	}
 	if !isValid {
-		return message, errors.New("user is not a partecipant")
+		return message, errors.New(constants.NotPartecipant)
 	}
 
 	if forwarded {
 		conversation_id = target_id
 	}
 
-	err = db.c.QueryRow(`
-		INSERT INTO Messages (conversation_id,user_id,content,media,type,timestamp,status,isForwarded) 
-		VALUES (?,?,?,?,?,?,?,?) RETURNING message_id;`,
+	err = db.checkClientId("Messages", user_id, client_message_id)
+	if err != nil {
+		return message, err
+	}
+
+	expires_at, err := db.messageExpiry(conversation_id, current_time)
+	if err != nil {
+		return message, err
+	}
+
+	// A concurrent retry may insert the same client id after the check, then no row is returned
+	err = tx.QueryRow(`
+		INSERT INTO Messages (conversation_id,user_id,content,media,type,timestamp,status,isForwarded,expires_at,client_message_id) 
+		VALUES (?,?,?,?,?,?,?,?,?,?) ON CONFLICT DO NOTHING RETURNING message_id;`,
 		conversation_id,
 		user_id,
 		content,
@@ -199,12 +429,30 @@ func (db *appdbimpl) CreateMessage(user_id int64, conversation_id int64, target_
 		current_time,
 		"sent",
 		forwarded,
+		expires_at,
+		nullableClientId(client_message_id),
 	).Scan(&message_id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return message, errors.New(constants.DuplicateClientMessageId)
+	}
+	if err != nil {
+		return message, err
+	}
+
+	err = createReceipts(tx, message_id, conversation_id, user_id)
 	if err != nil {
 		return message, err
 	}
 
-	err = db.c.QueryRow(`SELECT * FROM Users WHERE user_id = ?`, user_id).Scan(&user.User_id, &user.Username, &user.Photo)
+	// The mentions of a forwarded message name the participants of another conversation
+	if !forwarded {
+		message.Mentions, err = db.recordMentions(tx, conversation_id, message_id, 0, user_id, content, current_time)
+		if err != nil {
+			return message, err
+		}
+	}
+
+	user, err = db.GetUser(user_id)
 	if err != nil {
 		return message, err
 	}
@@ -216,18 +464,21 @@ func (db *appdbimpl) CreateMessage(user_id int64, conversation_id int64, target_
 	message.Content = content
 	message.Media = media
 	message.Status = "sent"
+	message.Reactions = make([]models.ReactionSummary, 0)
 	message.Forwarded = forwarded
+	message.ExpiresAt = expires_at
+	message.ClientMessageId = client_message_id
 
 	return message, nil
 }
 
-func (db *appdbimpl) ReplyToMessage(user_id int64, conversation_id int64, reply_to_id int64, typeMessage string, content string, media []byte) (models.Message, error) {
+func (db *appdbimpl) ReplyToMessage(user_id int64, conversation_id int64, reply_to_id int64, typeMessage string, content string, media []byte, client_message_id string) (models.Message, error) {
 	var message_id int64
 	var message models.Message
 	var user models.User
 	var originalSender models.User
 
-	current_time := time.Now().Unix()
+	current_time := globaltime.Now().Unix()
 
 	isValid, err := db.CheckUserConversation(user_id, conversation_id)
 	if err != nil {
@@ -237,14 +488,21 @@ func (db *appdbimpl) ReplyToMessage(user_id int64, conversation_id int64, reply_
 		return message, errors.New("user is not a partecipant")
 	}
 
+	// A retry is recognised even if the original message was deleted in the meantime
+	err = db.checkClientId("Messages", user_id, client_message_id)
+	if err != nil {
+		return message, err
+	}
+
 	var messageExists bool
 	var originalSenderId int64
 	var originalContent string
 
 	err = db.c.QueryRow(`
 		SELECT EXISTS (
-			SELECT 1 FROM Messages 
-			WHERE message_id = ? AND conversation_id = ?
+			SELECT 1
+			FROM Messages m
+			WHERE m.message_id = ? AND m.conversation_id = ? AND m.deleted = 0 AND `+notExpiredCondition()+`
 		)`, reply_to_id, conversation_id).Scan(&messageExists)
 
 	if err != nil {
@@ -271,9 +529,20 @@ func (db *appdbimpl) ReplyToMessage(user_id int64, conversation_id int64, reply_
 		return message, err
 	}
 
-	err = db.c.QueryRow(`
-		INSERT INTO Messages (conversation_id, user_id, content, media, type, timestamp, status, isForwarded, reply_to_id) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING message_id;`,
+	expires_at, err := db.messageExpiry(conversation_id, current_time)
+	if err != nil {
+		return message, err
+	}
+
+	// The reply is stored with its receipts, mentions and inbox items, or not at all
+	tx, err := db.c.Begin()
+	if err != nil {
+		return message, err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO Messages (conversation_id, user_id, content, media, type, timestamp, status, isForwarded, reply_to_id, expires_at, client_message_id) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING RETURNING message_id;`,
 		conversation_id,
 		user_id,
 		content,
@@ -283,13 +552,45 @@ func (db *appdbimpl) ReplyToMessage(user_id int64, conversation_id int64, reply_
 		"sent",
 		false,
 		reply_to_id,
+		expires_at,
+		nullableClientId(client_message_id),
 	).Scan(&message_id)
 
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = tx.Rollback()
+		return message, errors.New(constants.DuplicateClientMessageId)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	err = createReceipts(tx, message_id, conversation_id, user_id)
 	if err != nil {
+		_ = tx.Rollback()
 		return message, err
 	}
 
-	err = db.c.QueryRow(`SELECT * FROM Users WHERE user_id = ?`, user_id).Scan(&user.User_id, &user.Username, &user.Photo)
+	message.Mentions, err = db.recordMentions(tx, conversation_id, message_id, 0, user_id, content, current_time)
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	if originalSenderId != user_id {
+		err = addInboxItem(tx, originalSenderId, conversation_id, message_id, 0, "reply", current_time)
+		if err != nil {
+			_ = tx.Rollback()
+			return message, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return message, err
+	}
+
+	user, err = db.GetUser(user_id)
 	if err != nil {
 		return message, err
 	}
@@ -301,7 +602,10 @@ func (db *appdbimpl) ReplyToMessage(user_id int64, conversation_id int64, reply_
 	message.Content = content
 	message.Media = media
 	message.Status = "sent"
+	message.Reactions = make([]models.ReactionSummary, 0)
 	message.Forwarded = false
+	message.ExpiresAt = expires_at
+	message.ClientMessageId = client_message_id
 	message.ReplyTo = &models.ReplyInfo{
 		ID:      reply_to_id,
 		Content: originalContent,
@@ -325,9 +629,9 @@ func (db *appdbimpl) DeleteMessage(user_id int64, conversation_id int64, message
 		SELECT EXISTS(
 			SELECT 1
 			FROM Messages
-			WHERE message_id = ? AND user_id = ?
+			WHERE message_id = ? AND user_id = ? AND conversation_id = ? AND deleted = 0
 		);`,
-		message_id, user_id).Scan(&exists)
+		message_id, user_id, conversation_id).Scan(&exists)
 
 	if err != nil {
 		return err
@@ -336,21 +640,241 @@ func (db *appdbimpl) DeleteMessage(user_id int64, conversation_id int64, message
 		return errors.New("this message doesn't belogs from this user")
 	}
 
-	_, err = db.c.Exec("DELETE FROM Messages WHERE user_id = ? AND message_id = ?;", user_id, message_id)
+	// The row stays as a tombstone, so that replies and the order of the conversation are kept. Its content stays in
+	// the trash of the sender until PurgeDeletedMessages erases it
+	_, err = db.c.Exec("UPDATE Messages SET deleted = 1, deleted_at = ? WHERE message_id = ?;", globaltime.Now().Unix(), message_id)
+	return err
+}
+
+func (db *appdbimpl) RestoreMessage(user_id int64, conversation_id int64, message_id int64, deleted_after int64) error {
+	isValid, err := db.CheckUserConversation(user_id, conversation_id)
+	if err != nil {
+		return err
+	}
+	if !isValid {
+		return errors.New("user is not a partecipant")
+	}
+
+	var sender_id int64
+	var deleted_at *int64
+	err = db.c.QueryRow(`
+		SELECT user_id, deleted_at
+		FROM Messages
+		WHERE message_id = ? AND conversation_id = ? AND deleted = 1`,
+		message_id, conversation_id).Scan(&sender_id, &deleted_at)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New(constants.MessageNotFound)
+		}
+		return err
+	}
+	if sender_id != user_id {
+		return errors.New(constants.NotMessageSender)
+	}
+	if deleted_at == nil || *deleted_at < deleted_after {
+		return errors.New(constants.UndoWindowExpired)
+	}
+
+	_, err = db.c.Exec("UPDATE Messages SET deleted = 0, deleted_at = NULL WHERE message_id = ? AND deleted = 1;", message_id)
+	return err
+}
+
+func (db *appdbimpl) GetTrash(user_id int64, deleted_after int64) ([]models.TrashedMessage, error) {
+	trash := make([]models.TrashedMessage, 0)
+
+	sender, err := db.GetUser(user_id)
+	if err != nil {
+		return trash, err
+	}
+
+	rows, err := db.c.Query(`
+		SELECT m.conversation_id, m.message_id, m.timestamp, m.type, m.content, m.media, m.isForwarded, m.edited_at, m.deleted_at
+		FROM Messages m
+		JOIN Partecipants p ON p.conversation_id = m.conversation_id AND p.user_id = m.user_id
+		WHERE m.user_id = ? AND m.deleted = 1 AND m.deleted_at >= ?
+		ORDER BY m.deleted_at DESC`,
+		user_id, deleted_after)
+	if err != nil {
+		return trash, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var trashed models.TrashedMessage
+		var content *string
+
+		err = rows.Scan(
+			&trashed.Conversation_id,
+			&trashed.Message.Message_id,
+			&trashed.Message.Timestamp,
+			&trashed.Message.Type,
+			&content,
+			&trashed.Message.Media,
+			&trashed.Message.Forwarded,
+			&trashed.Message.EditedAt,
+			&trashed.DeletedAt,
+		)
+		if err != nil {
+			return trash, err
+		}
+
+		if content != nil {
+			trashed.Message.Content = *content
+		}
+		trashed.Message.Sender = sender
+		trashed.Message.Status = "sent"
+		trashed.Message.Deleted = true
+
+		trash = append(trash, trashed)
+	}
+	if rows.Err() != nil {
+		return trash, rows.Err()
+	}
+
+	return trash, nil
+}
+
+func (db *appdbimpl) PurgeDeletedMessages(deleted_before int64) (int, error) {
+	rows, err := db.c.Query(`SELECT message_id FROM Messages WHERE deleted = 1 AND deleted_at < ?`, deleted_before)
+	if err != nil {
+		return 0, err
+	}
+
+	var message_ids []int64
+	for rows.Next() {
+		var message_id int64
+		err = rows.Scan(&message_id)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		message_ids = append(message_ids, message_id)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return 0, rows.Err()
+	}
+
+	for i, message_id := range message_ids {
+		tx, err := db.c.Begin()
+		if err != nil {
+			return i, err
+		}
+
+		// A NULL deleted_at tells the tombstone can't be restored anymore
+		_, err = tx.Exec("UPDATE Messages SET deleted_at = NULL WHERE message_id = ?;", message_id)
+		if err != nil {
+			_ = tx.Rollback()
+			return i, err
+		}
+
+		err = clearMessage(tx, message_id)
+		if err != nil {
+			_ = tx.Rollback()
+			return i, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(message_ids), nil
+}
+
+// deleteMessage removes a message for good, with every row depending on it. Foreign keys aren't enforced, so
+// ON DELETE CASCADE doesn't apply.
+func deleteMessage(tx *sql.Tx, message_id int64) error {
+	err := clearMessage(tx, message_id)
+	if err != nil {
+		return err
+	}
+
+	// The replies of a thread whose root is gone move to the timeline, so that they can still be read
+	_, err = tx.Exec(`UPDATE Messages SET thread_root_id = NULL WHERE thread_root_id = ?;`, message_id)
 	if err != nil {
 		return err
 	}
 
+	for _, table := range []string{"Receipts", "HiddenMessages", "Messages"} {
+		_, err = tx.Exec(`DELETE FROM "`+table+`" WHERE message_id = ?;`, message_id)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (db *appdbimpl) ForwardMessage(user_id int64, conversation_id int64, target_id int64, message_id int64) (models.Message, error) {
+// clearMessage erases the content of a deleted message, with its location, revisions, mentions, reactions, pins, stars,
+// poll and comments
+func clearMessage(tx *sql.Tx, message_id int64) error {
+	_, err := tx.Exec(`
+		UPDATE Messages
+		SET content = '', media = NULL, edited_at = NULL, latitude = NULL, longitude = NULL, accuracy = NULL,
+		    place_label = NULL, location_updated_at = NULL, live_until = NULL
+		WHERE message_id = ?;`, message_id)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"MessageEdits", "Mentions", "InboxItems", "Reactions", "Pins", "Stars", "PollVotes", "PollOptions", "Polls"} {
+		_, err = tx.Exec(`DELETE FROM "`+table+`" WHERE message_id = ?;`, message_id)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM Comments WHERE message_id = ?;", message_id)
+	return err
+}
+
+func (db *appdbimpl) HideMessage(user_id int64, conversation_id int64, message_id int64) error {
+	isValid, err := db.CheckUserConversation(user_id, conversation_id)
+	if err != nil {
+		return err
+	}
+	if !isValid {
+		return errors.New("user is not a partecipant")
+	}
+
+	var exists bool
+	err = db.c.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1
+			FROM Messages
+			WHERE message_id = ? AND conversation_id = ?
+		);`,
+		message_id, conversation_id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New(constants.MessageNotFound)
+	}
+
+	_, err = db.c.Exec("INSERT OR IGNORE INTO HiddenMessages (user_id, message_id) VALUES (?, ?);", user_id, message_id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) ForwardMessage(user_id int64, conversation_id int64, target_id int64, message_id int64, client_message_id string) (models.Message, error) {
 	var message models.Message
 
-	err := db.c.QueryRow(`
-	SELECT type,content,media 
-	FROM Messages WHERE message_id = ?`,
-		message_id).Scan(
+	err := db.checkClientId("Messages", user_id, client_message_id)
+	if err != nil {
+		return message, err
+	}
+
+	// Live locations are shared by their sender only, so they can't be forwarded, unlike locations
+	err = db.c.QueryRow(`
+	SELECT m.type,m.content,m.media 
+	FROM Messages m WHERE m.message_id = ? AND m.conversation_id = ? AND m.deleted = 0 AND m.type NOT IN ('system', 'poll', 'live_location') AND `+notExpiredCondition()+``,
+		message_id, conversation_id).Scan(
 		&message.Type,
 		&message.Content,
 		&message.Media,
@@ -359,10 +883,33 @@ func (db *appdbimpl) ForwardMessage(user_id int64, conversation_id int64, target
 		return message, err
 	}
 
-	messageForwarded, err := db.CreateMessage(user_id, conversation_id, target_id, message.Type, message.Content, message.Media, true)
+	tx, err := db.c.Begin()
+	if err != nil {
+		return message, err
+	}
+
+	messageForwarded, err := db.insertMessage(tx, user_id, conversation_id, target_id, message.Type, message.Content, message.Media, true, client_message_id)
 	if err != nil {
+		_ = tx.Rollback()
 		return message, err
 	}
 
+	if message.Type == "location" {
+		err = copyLocation(tx, message_id, messageForwarded.Message_id)
+		if err != nil {
+			_ = tx.Rollback()
+			return message, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return message, err
+	}
+
+	if message.Type == "location" {
+		return db.getMessage(user_id, target_id, messageForwarded.Message_id)
+	}
+
 	return messageForwarded, nil
 }
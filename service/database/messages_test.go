@@ -0,0 +1,124 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+// pageIds returns the ids of the messages of page
+func pageIds(page models.MessagePage) []int64 {
+	message_ids := make([]int64, 0, len(page.Messages))
+	for _, message := range page.Messages {
+		message_ids = append(message_ids, message.Message_id)
+	}
+	return message_ids
+}
+
+// checkPage fails the test if page doesn't hold the messages want, in order, with the given cursors (0 for none)
+func checkPage(t *testing.T, name string, page models.MessagePage, want []int64, older int64, newer int64) {
+	t.Helper()
+
+	got := pageIds(page)
+	ok := len(got) == len(want)
+	for i := 0; ok && i < len(got); i++ {
+		ok = got[i] == want[i]
+	}
+	if !ok {
+		t.Errorf("%s: messages %v, want %v", name, got, want)
+	}
+
+	cursor := func(c *int64) int64 {
+		if c == nil {
+			return 0
+		}
+		return *c
+	}
+	if cursor(page.OlderCursor) != older || cursor(page.NewerCursor) != newer {
+		t.Errorf("%s: cursors %d and %d, want %d and %d", name, cursor(page.OlderCursor), cursor(page.NewerCursor), older, newer)
+	}
+}
+
+func TestGetMessagesPage(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, conversation_id := newTestConversation(t, db)
+
+	m := make([]int64, 5)
+	for i := range m {
+		m[i] = sendText(t, db, alice, conversation_id, "message")
+	}
+
+	page, err := db.GetMessagesPage(bob, conversation_id, 0, 0, 2)
+	if err != nil {
+		t.Fatalf("GetMessagesPage: %v", err)
+	}
+	checkPage(t, "latest page", page, []int64{m[3], m[4]}, m[3], 0)
+
+	page, err = db.GetMessagesPage(bob, conversation_id, *page.OlderCursor, 0, 2)
+	if err != nil {
+		t.Fatalf("GetMessagesPage: %v", err)
+	}
+	checkPage(t, "older page", page, []int64{m[1], m[2]}, m[1], m[2])
+
+	page, err = db.GetMessagesPage(bob, conversation_id, *page.OlderCursor, 0, 2)
+	if err != nil {
+		t.Fatalf("GetMessagesPage: %v", err)
+	}
+	checkPage(t, "oldest page", page, []int64{m[0]}, 0, m[0])
+
+	// Walking forward the oldest messages past the cursor come first
+	page, err = db.GetMessagesPage(bob, conversation_id, 0, m[0], 2)
+	if err != nil {
+		t.Fatalf("GetMessagesPage: %v", err)
+	}
+	checkPage(t, "newer page", page, []int64{m[1], m[2]}, m[1], m[2])
+
+	page, err = db.GetMessagesPage(bob, conversation_id, m[4], m[1], 10)
+	if err != nil {
+		t.Fatalf("GetMessagesPage: %v", err)
+	}
+	checkPage(t, "page between cursors", page, []int64{m[2], m[3]}, m[2], m[3])
+}
+
+func TestGetMessagesAround(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, conversation_id := newTestConversation(t, db)
+
+	m := make([]int64, 5)
+	for i := range m {
+		m[i] = sendText(t, db, alice, conversation_id, "message")
+	}
+
+	page, err := db.GetMessagesAround(bob, conversation_id, m[2], 2)
+	if err != nil {
+		t.Fatalf("GetMessagesAround: %v", err)
+	}
+	checkPage(t, "window in the middle", page, []int64{m[1], m[2], m[3]}, m[1], m[3])
+
+	page, err = db.GetMessagesAround(bob, conversation_id, m[0], 4)
+	if err != nil {
+		t.Fatalf("GetMessagesAround: %v", err)
+	}
+	checkPage(t, "window at the start", page, []int64{m[0], m[1], m[2]}, 0, m[2])
+
+	page, err = db.GetMessagesAround(bob, conversation_id, m[4], 4)
+	if err != nil {
+		t.Fatalf("GetMessagesAround: %v", err)
+	}
+	checkPage(t, "window at the end", page, []int64{m[2], m[3], m[4]}, m[2], 0)
+
+	// The anchor must be in the conversation
+	carol, err := db.Login("carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other_id, err := db.CreateConversation(carol, "", "private", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.GetMessagesAround(bob, int64(other_id), m[2], 2)
+	if err == nil || err.Error() != constants.MessageNotFound {
+		t.Errorf("anchor of another conversation: %v, want %s", err, constants.MessageNotFound)
+	}
+}
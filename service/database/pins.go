@@ -0,0 +1,199 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+func (db *appdbimpl) PinMessage(user_id int64, conversation_id int64, message_id int64, max_pins int) (models.Message, error) {
+	var message models.Message
+
+	canManage, err := db.canManageConversation(user_id, conversation_id)
+	if err != nil {
+		return message, err
+	}
+	if !canManage {
+		return message, errors.New(constants.NotGroupAdmin)
+	}
+
+	var exists bool
+	err = db.c.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1
+			FROM Messages m
+			WHERE m.message_id = ? AND m.conversation_id = ? AND m.deleted = 0 AND m.type != 'system'
+			      AND `+notHiddenCondition+` AND `+notExpiredCondition()+`
+		)`, message_id, conversation_id, user_id).Scan(&exists)
+	if err != nil {
+		return message, err
+	}
+	if !exists {
+		return message, errors.New(constants.MessageNotFound)
+	}
+
+	user, err := db.GetUser(user_id)
+	if err != nil {
+		return message, err
+	}
+
+	now := globaltime.Now().Unix()
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return message, err
+	}
+
+	// Pins of deleted or expired messages don't show, so they don't count either
+	var pinned bool
+	var pins int
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(p.message_id = ?), 0), COUNT(*)
+		FROM Pins p
+		JOIN Messages m ON m.message_id = p.message_id
+		WHERE p.conversation_id = ? AND m.deleted = 0 AND `+notExpiredCondition(),
+		message_id, conversation_id).Scan(&pinned, &pins)
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+	if pinned {
+		_ = tx.Rollback()
+		return message, errors.New(constants.MessageAlreadyPinned)
+	}
+	if pins >= max_pins {
+		_ = tx.Rollback()
+		return message, errors.New(constants.TooManyPins)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO Pins (conversation_id, message_id, pinned_by, timestamp) VALUES (?, ?, ?, ?)`,
+		conversation_id, message_id, user_id, now)
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	// The notice quotes the pinned message, so that clients can jump to it. Like the one of the timer, it never
+	// disappears.
+	var notice_id int64
+	err = tx.QueryRow(`
+		INSERT INTO Messages (conversation_id, user_id, content, type, timestamp, status, isForwarded, reply_to_id)
+		VALUES (?, ?, ?, 'system', ?, 'sent', 0, ?) RETURNING message_id;`,
+		conversation_id, user_id, user.Username+" pinned a message", now, message_id).Scan(&notice_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	err = createReceipts(tx, notice_id, conversation_id, user_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return message, err
+	}
+
+	messages, err := db.queryMessages(user_id, conversation_id, " AND m.message_id = ?", notice_id)
+	if err != nil {
+		return message, err
+	}
+	if len(messages) == 0 {
+		return message, errors.New(constants.MessageNotFound)
+	}
+
+	return messages[0], nil
+}
+
+func (db *appdbimpl) UnpinMessage(user_id int64, conversation_id int64, message_id int64) error {
+	canManage, err := db.canManageConversation(user_id, conversation_id)
+	if err != nil {
+		return err
+	}
+	if !canManage {
+		return errors.New(constants.NotGroupAdmin)
+	}
+
+	result, err := db.c.Exec(`DELETE FROM Pins WHERE conversation_id = ? AND message_id = ?`, conversation_id, message_id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New(constants.MessageNotPinned)
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) GetPinnedMessages(user_id int64, conversation_id int64) ([]models.PinnedMessage, error) {
+	pinned := make([]models.PinnedMessage, 0)
+
+	isValid, err := db.CheckUserConversation(user_id, conversation_id)
+	if err != nil {
+		return pinned, err
+	}
+	if !isValid {
+		return pinned, errors.New("user is not a partecipant")
+	}
+
+	messages, err := db.queryMessages(user_id, conversation_id, `
+		AND m.deleted = 0 AND m.message_id IN (SELECT message_id FROM Pins WHERE conversation_id = ?)`, conversation_id)
+	if err != nil {
+		return pinned, err
+	}
+
+	visible := make(map[int64]models.Message, len(messages))
+	for _, message := range messages {
+		visible[message.Message_id] = message
+	}
+
+	rows, err := db.c.Query(`
+		SELECT message_id, pinned_by, timestamp
+		FROM Pins
+		WHERE conversation_id = ?
+		ORDER BY timestamp DESC, rowid DESC`, conversation_id)
+	if err != nil {
+		return pinned, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var message_id int64
+		var pinned_by int64
+		var pin models.PinnedMessage
+
+		err = rows.Scan(&message_id, &pinned_by, &pin.PinnedAt)
+		if err != nil {
+			return pinned, err
+		}
+
+		message, ok := visible[message_id]
+		if !ok {
+			continue
+		}
+		pin.Message = message
+
+		pin.PinnedBy, err = db.GetUser(pinned_by)
+		if err != nil {
+			pin.PinnedBy.User_id = pinned_by
+			pin.PinnedBy.Username = "User"
+		}
+
+		pinned = append(pinned, pin)
+	}
+	if rows.Err() != nil {
+		return pinned, rows.Err()
+	}
+
+	return pinned, nil
+}
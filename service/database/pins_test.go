@@ -0,0 +1,78 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/maisto1/WasaText/service/constants"
+)
+
+func TestPinMessageLimit(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, conversation_id := newTestConversation(t, db)
+
+	first := sendText(t, db, alice, conversation_id, "first")
+	second := sendText(t, db, bob, conversation_id, "second")
+	third := sendText(t, db, alice, conversation_id, "third")
+	receipts := countRows(t, db, "Receipts")
+
+	for _, message_id := range []int64{first, second} {
+		if _, err := db.PinMessage(alice, conversation_id, message_id, 2); err != nil {
+			t.Fatalf("PinMessage: %v", err)
+		}
+	}
+	if count := countRows(t, db, "Receipts"); count != receipts+2 {
+		t.Errorf("%d receipts for the pin notices, want 2", count-receipts)
+	}
+
+	_, err := db.PinMessage(alice, conversation_id, first, 2)
+	if err == nil || err.Error() != constants.MessageAlreadyPinned {
+		t.Errorf("pinning a pinned message: %v, want %s", err, constants.MessageAlreadyPinned)
+	}
+
+	_, err = db.PinMessage(alice, conversation_id, third, 2)
+	if err == nil || err.Error() != constants.TooManyPins {
+		t.Errorf("pinning past the limit: %v, want %s", err, constants.TooManyPins)
+	}
+
+	// The pin of a deleted message doesn't count anymore
+	err = db.DeleteMessage(bob, conversation_id, second)
+	if err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	if _, err = db.PinMessage(alice, conversation_id, third, 2); err != nil {
+		t.Errorf("pinning after a pinned message was deleted: %v", err)
+	}
+
+	pinned, err := db.GetPinnedMessages(bob, conversation_id)
+	if err != nil {
+		t.Fatalf("GetPinnedMessages: %v", err)
+	}
+	if len(pinned) != 2 || pinned[0].Message.Message_id != third || pinned[1].Message.Message_id != first {
+		t.Errorf("got %d pinned messages, want the third and the first", len(pinned))
+	}
+}
+
+func TestPinMessageStoresNothingOnFailure(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, _, conversation_id := newTestConversation(t, db)
+	message_id := sendText(t, db, alice, conversation_id, "pin me")
+
+	_, err := db.(*appdbimpl).c.Exec(`
+		CREATE TRIGGER fail_receipt BEFORE INSERT ON Receipts
+		BEGIN SELECT RAISE(ABORT, 'receipt refused'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.PinMessage(alice, conversation_id, message_id, 3)
+	if err == nil {
+		t.Fatal("PinMessage succeeded although the receipts couldn't be stored")
+	}
+
+	if count := countRows(t, db, "Pins"); count != 0 {
+		t.Errorf("%d pins left by the failed pin", count)
+	}
+	if count := countRows(t, db, "Messages"); count != 1 {
+		t.Errorf("%d messages after the failed pin, want the pinned one only", count)
+	}
+}
@@ -0,0 +1,318 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+func (db *appdbimpl) CreatePoll(user_id int64, conversation_id int64, poll models.PollDraft, client_message_id string) (models.Message, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	// A poll message without its poll would be empty, so both are stored together
+	message, err := db.insertMessage(tx, user_id, conversation_id, 0, "poll", poll.Question, nil, false, client_message_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	err = insertPoll(tx, message.Message_id, poll)
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return message, err
+	}
+
+	return db.getMessage(user_id, conversation_id, message.Message_id)
+}
+
+// insertPoll stores the poll of the message message_id
+func insertPoll(tx *sql.Tx, message_id int64, poll models.PollDraft) error {
+	_, err := tx.Exec(`INSERT INTO Polls (message_id, multiple_choice, anonymous, closes_at) VALUES (?, ?, ?, ?)`,
+		message_id, poll.MultipleChoice, poll.Anonymous, poll.ClosesAt)
+	if err != nil {
+		return err
+	}
+
+	for position, option := range poll.Options {
+		_, err = tx.Exec(`INSERT INTO PollOptions (message_id, position, text) VALUES (?, ?, ?)`, message_id, position, option)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pollClosedCondition tells whether the poll aliased as p was closed by its sender or its closing time passed. The
+// current time is inlined, as in notExpiredCondition.
+func pollClosedCondition() string {
+	return `(p.closed_at IS NOT NULL OR COALESCE(p.closes_at <= ` + strconv.FormatInt(globaltime.Now().Unix(), 10) + `, 0))`
+}
+
+func (db *appdbimpl) VotePoll(user_id int64, conversation_id int64, message_id int64, option_ids []int64) (models.Message, error) {
+	var message models.Message
+
+	err := db.checkVisibleMessage(user_id, conversation_id, message_id)
+	if err != nil {
+		return message, err
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return message, err
+	}
+
+	// Checked in the transaction, so that no vote gets in once the poll is closed
+	var multiple_choice bool
+	var closed bool
+	err = tx.QueryRow(`SELECT p.multiple_choice, `+pollClosedCondition()+` FROM Polls p WHERE p.message_id = ?`,
+		message_id).Scan(&multiple_choice, &closed)
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return message, errors.New(constants.NotAPoll)
+		}
+		return message, err
+	}
+	if closed {
+		_ = tx.Rollback()
+		return message, errors.New(constants.PollClosed)
+	}
+	if len(option_ids) > 1 && !multiple_choice {
+		_ = tx.Rollback()
+		return message, errors.New(constants.InvalidPollVote)
+	}
+
+	_, err = tx.Exec(`DELETE FROM PollVotes WHERE message_id = ? AND user_id = ?`, message_id, user_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	now := globaltime.Now().Unix()
+	for _, option_id := range option_ids {
+		// Options of other polls insert nothing
+		result, err := tx.Exec(`
+			INSERT INTO PollVotes (message_id, option_id, user_id, timestamp)
+			SELECT message_id, option_id, ?, ? FROM PollOptions WHERE option_id = ? AND message_id = ?`,
+			user_id, now, option_id, message_id)
+		if err != nil {
+			_ = tx.Rollback()
+			return message, err
+		}
+
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			_ = tx.Rollback()
+			return message, err
+		}
+		if inserted == 0 {
+			_ = tx.Rollback()
+			return message, errors.New(constants.InvalidPollVote)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return message, err
+	}
+
+	return db.getMessage(user_id, conversation_id, message_id)
+}
+
+func (db *appdbimpl) ClosePoll(user_id int64, conversation_id int64, message_id int64) (models.Message, error) {
+	var message models.Message
+
+	err := db.checkVisibleMessage(user_id, conversation_id, message_id)
+	if err != nil {
+		return message, err
+	}
+
+	var sender_id int64
+	var closed bool
+	err = db.c.QueryRow(`
+		SELECT m.user_id, `+pollClosedCondition()+`
+		FROM Polls p
+		JOIN Messages m ON m.message_id = p.message_id
+		WHERE p.message_id = ?`, message_id).Scan(&sender_id, &closed)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return message, errors.New(constants.NotAPoll)
+		}
+		return message, err
+	}
+	if sender_id != user_id {
+		return message, errors.New(constants.NotMessageSender)
+	}
+	if closed {
+		return message, errors.New(constants.PollClosed)
+	}
+
+	_, err = db.c.Exec(`UPDATE Polls SET closed_at = ? WHERE message_id = ? AND closed_at IS NULL`,
+		globaltime.Now().Unix(), message_id)
+	if err != nil {
+		return message, err
+	}
+
+	return db.getMessage(user_id, conversation_id, message_id)
+}
+
+// fillPolls sets the poll of the poll messages, with the results as seen by user_id. Deleted messages show no poll.
+func (db *appdbimpl) fillPolls(user_id int64, messages []models.Message) error {
+	positions := make(map[int64]int)
+	message_ids := make([]interface{}, 0)
+
+	for i := range messages {
+		if messages[i].Type != "poll" || messages[i].Deleted {
+			continue
+		}
+		positions[messages[i].Message_id] = i
+		message_ids = append(message_ids, messages[i].Message_id)
+	}
+
+	return forEachBatch(message_ids, func(placeholders string, batch []interface{}) error {
+		err := db.loadPolls(messages, positions, placeholders, batch)
+		if err != nil {
+			return err
+		}
+
+		err = db.loadPollOptions(messages, positions, placeholders, batch)
+		if err != nil {
+			return err
+		}
+
+		return db.loadPollVotes(user_id, messages, positions, placeholders, batch)
+	})
+}
+
+// loadPolls sets the poll of the messages in batch, at their positions
+func (db *appdbimpl) loadPolls(messages []models.Message, positions map[int64]int, placeholders string, batch []interface{}) error {
+	rows, err := db.c.Query(`
+		SELECT p.message_id, p.multiple_choice, p.anonymous, p.closes_at, p.closed_at, `+pollClosedCondition()+`
+		FROM Polls p
+		WHERE p.message_id IN (`+placeholders+`)`, batch...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var message_id int64
+		poll := models.Poll{Options: make([]models.PollOption, 0)}
+
+		err = rows.Scan(&message_id, &poll.MultipleChoice, &poll.Anonymous, &poll.ClosesAt, &poll.ClosedAt, &poll.Closed)
+		if err != nil {
+			return err
+		}
+
+		message := &messages[positions[message_id]]
+		poll.Question = message.Content
+		message.Poll = &poll
+	}
+
+	return rows.Err()
+}
+
+// loadPollOptions adds the options to the polls of the messages in batch, loaded by loadPolls
+func (db *appdbimpl) loadPollOptions(messages []models.Message, positions map[int64]int, placeholders string, batch []interface{}) error {
+	rows, err := db.c.Query(`
+		SELECT message_id, option_id, text
+		FROM PollOptions
+		WHERE message_id IN (`+placeholders+`)
+		ORDER BY message_id, position`, batch...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var message_id int64
+		var option models.PollOption
+
+		err = rows.Scan(&message_id, &option.Option_id, &option.Text)
+		if err != nil {
+			return err
+		}
+
+		poll := messages[positions[message_id]].Poll
+		if poll != nil {
+			poll.Options = append(poll.Options, option)
+		}
+	}
+
+	return rows.Err()
+}
+
+// loadPollVotes counts the votes of the polls of the messages in batch, loaded by loadPollOptions. Voters who left the
+// conversation are counted but not listed.
+func (db *appdbimpl) loadPollVotes(user_id int64, messages []models.Message, positions map[int64]int, placeholders string, batch []interface{}) error {
+	rows, err := db.c.Query(`
+		SELECT v.message_id, v.option_id, v.user_id, EXISTS (
+			SELECT 1
+			FROM Messages m
+			JOIN Partecipants p ON p.conversation_id = m.conversation_id
+			WHERE m.message_id = v.message_id AND p.user_id = v.user_id
+		)
+		FROM PollVotes v
+		WHERE v.message_id IN (`+placeholders+`)
+		ORDER BY v.message_id, v.timestamp, v.user_id`, batch...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	voters := make(map[int64]map[int64]bool)
+	for rows.Next() {
+		var message_id int64
+		var option_id int64
+		var voter_id int64
+		var participant bool
+
+		err = rows.Scan(&message_id, &option_id, &voter_id, &participant)
+		if err != nil {
+			return err
+		}
+
+		poll := messages[positions[message_id]].Poll
+		if poll == nil {
+			continue
+		}
+
+		if voters[message_id] == nil {
+			voters[message_id] = make(map[int64]bool)
+		}
+		if !voters[message_id][voter_id] {
+			voters[message_id][voter_id] = true
+			poll.VoterCount++
+		}
+
+		for i := range poll.Options {
+			option := &poll.Options[i]
+			if option.Option_id != option_id {
+				continue
+			}
+
+			option.Votes++
+			if voter_id == user_id {
+				option.Voted = true
+			}
+			if participant && !poll.Anonymous {
+				option.Voters = append(option.Voters, db.userOrPlaceholder(voter_id))
+			}
+		}
+	}
+
+	return rows.Err()
+}
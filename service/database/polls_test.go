@@ -0,0 +1,61 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/maisto1/WasaText/service/models"
+)
+
+func TestCreatePoll(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, _, conversation_id := newTestConversation(t, db)
+
+	message, err := db.CreatePoll(alice, conversation_id, models.PollDraft{
+		Question: "Pizza or sushi?",
+		Options:  []string{"Pizza", "Sushi"},
+	}, "")
+	if err != nil {
+		t.Fatalf("CreatePoll: %v", err)
+	}
+	if message.Poll == nil || len(message.Poll.Options) != 2 {
+		t.Fatalf("CreatePoll returned poll %+v, want 2 options", message.Poll)
+	}
+	if countRows(t, db, "Receipts") != 1 {
+		t.Errorf("the poll has no receipt for the other participant")
+	}
+}
+
+func TestCreatePollStoresNothingOnFailure(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, _, conversation_id := newTestConversation(t, db)
+
+	_, err := db.(*appdbimpl).c.Exec(`
+		CREATE TRIGGER fail_option BEFORE INSERT ON PollOptions WHEN NEW.text = 'Fail'
+		BEGIN SELECT RAISE(ABORT, 'option refused'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.CreatePoll(alice, conversation_id, models.PollDraft{
+		Question: "Pizza or sushi?",
+		Options:  []string{"Pizza", "Fail"},
+	}, "retry-1")
+	if err == nil {
+		t.Fatal("CreatePoll succeeded although an option couldn't be stored")
+	}
+
+	for _, table := range []string{"Messages", "Receipts", "Polls", "PollOptions"} {
+		if count := countRows(t, db, table); count != 0 {
+			t.Errorf("%d rows left in %s by the failed poll", count, table)
+		}
+	}
+
+	// The client id of the failed message is free for the retry
+	_, err = db.CreatePoll(alice, conversation_id, models.PollDraft{
+		Question: "Pizza or sushi?",
+		Options:  []string{"Pizza", "Sushi"},
+	}, "retry-1")
+	if err != nil {
+		t.Errorf("retry of the failed poll: %v", err)
+	}
+}
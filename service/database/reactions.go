@@ -0,0 +1,146 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+// checkVisibleMessage fails with MessageNotFound unless message_id is in the conversation of the user and not deleted,
+// hidden for the user or expired
+func (db *appdbimpl) checkVisibleMessage(user_id int64, conversation_id int64, message_id int64) error {
+	isValid, err := db.CheckUserConversation(user_id, conversation_id)
+	if err != nil {
+		return err
+	}
+	if !isValid {
+		return errors.New("user is not a partecipant")
+	}
+
+	var exists bool
+	err = db.c.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1
+			FROM Messages m
+			WHERE m.message_id = ? AND m.conversation_id = ? AND m.deleted = 0
+			      AND `+notHiddenCondition+` AND `+notExpiredCondition()+`
+		)`, message_id, conversation_id, user_id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New(constants.MessageNotFound)
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) SetReaction(user_id int64, conversation_id int64, message_id int64, emoji string) error {
+	err := db.checkVisibleMessage(user_id, conversation_id, message_id)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.c.Exec(`
+		INSERT INTO Reactions (message_id, user_id, emoji, timestamp) VALUES (?, ?, ?, ?)
+		ON CONFLICT (message_id, user_id) DO UPDATE SET emoji = excluded.emoji, timestamp = excluded.timestamp`,
+		message_id, user_id, emoji, globaltime.Now().Unix())
+	return err
+}
+
+func (db *appdbimpl) DeleteReaction(user_id int64, conversation_id int64, message_id int64) error {
+	err := db.checkVisibleMessage(user_id, conversation_id, message_id)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.c.Exec(`DELETE FROM Reactions WHERE message_id = ? AND user_id = ?`, message_id, user_id)
+	return err
+}
+
+func (db *appdbimpl) GetReactions(user_id int64, conversation_id int64, message_id int64) ([]models.Reaction, error) {
+	reactions := make([]models.Reaction, 0)
+
+	err := db.checkVisibleMessage(user_id, conversation_id, message_id)
+	if err != nil {
+		return reactions, err
+	}
+
+	rows, err := db.c.Query(`
+		SELECT user_id, emoji, timestamp
+		FROM Reactions
+		WHERE message_id = ?
+		ORDER BY timestamp DESC`, message_id)
+	if err != nil {
+		return reactions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reaction models.Reaction
+		var reactor_id int64
+
+		err = rows.Scan(&reactor_id, &reaction.Emoji, &reaction.Timestamp)
+		if err != nil {
+			return reactions, err
+		}
+
+		reaction.User, err = db.GetUser(reactor_id)
+		if err != nil {
+			reaction.User.User_id = reactor_id
+			reaction.User.Username = "User"
+		}
+
+		reactions = append(reactions, reaction)
+	}
+	if rows.Err() != nil {
+		return reactions, rows.Err()
+	}
+
+	return reactions, nil
+}
+
+// fillReactions sets the reactions summary of the messages, as seen by user_id. Deleted messages show no reactions.
+func (db *appdbimpl) fillReactions(user_id int64, messages []models.Message) error {
+	positions := make(map[int64]int, len(messages))
+	message_ids := make([]interface{}, 0, len(messages))
+
+	for i := range messages {
+		messages[i].Reactions = make([]models.ReactionSummary, 0)
+		if messages[i].Deleted {
+			continue
+		}
+		positions[messages[i].Message_id] = i
+		message_ids = append(message_ids, messages[i].Message_id)
+	}
+
+	return forEachBatch(message_ids, func(placeholders string, batch []interface{}) error {
+		rows, err := db.c.Query(`
+			SELECT message_id, emoji, COUNT(*), MAX(user_id = ?)
+			FROM Reactions
+			WHERE message_id IN (`+placeholders+`)
+			GROUP BY message_id, emoji
+			ORDER BY message_id, COUNT(*) DESC, MIN(timestamp)`, append([]interface{}{user_id}, batch...)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var message_id int64
+			var summary models.ReactionSummary
+
+			err = rows.Scan(&message_id, &summary.Emoji, &summary.Count, &summary.Reacted)
+			if err != nil {
+				return err
+			}
+
+			i := positions[message_id]
+			messages[i].Reactions = append(messages[i].Reactions, summary)
+		}
+
+		return rows.Err()
+	})
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+// messageStatusColumn derives the status of the message aliased as m from its receipts: "read" once read by all the
+// recipients, "delivered" once delivered to all of them, "sent" otherwise. Messages sent before receipts existed keep
+// their status column.
+const messageStatusColumn = `
+	CASE
+		WHEN NOT EXISTS (SELECT 1 FROM Receipts rc WHERE rc.message_id = m.message_id) THEN m.status
+		WHEN NOT EXISTS (SELECT 1 FROM Receipts rc WHERE rc.message_id = m.message_id AND rc.read_at IS NULL) THEN 'read'
+		WHEN NOT EXISTS (SELECT 1 FROM Receipts rc WHERE rc.message_id = m.message_id AND rc.delivered_at IS NULL) THEN 'delivered'
+		ELSE 'sent'
+	END`
+
+// createReceipts adds a pending receipt for every member of the conversation except the sender
+func createReceipts(ex execer, message_id int64, conversation_id int64, sender_id int64) error {
+	_, err := ex.Exec(`
+		INSERT INTO Receipts (message_id, user_id)
+		SELECT ?, user_id
+		FROM Partecipants
+		WHERE conversation_id = ? AND user_id != ?`,
+		message_id, conversation_id, sender_id)
+	return err
+}
+
+// markDelivered marks as delivered every message received by the user
+func (db *appdbimpl) markDelivered(user_id int64) error {
+	_, err := db.c.Exec(`
+		UPDATE Receipts SET delivered_at = ?
+		WHERE user_id = ? AND delivered_at IS NULL`,
+		globaltime.Now().Unix(), user_id)
+	return err
+}
+
+// markRead marks as read (and delivered) the messages of the conversation received by the user and matching filter,
+// as in queryMessages, moving the last read marker of the user forward past them. Replies in threads don't move the
+// marker, which follows the timeline.
+func (db *appdbimpl) markRead(user_id int64, conversation_id int64, filter string, args ...interface{}) error {
+	now := globaltime.Now().Unix()
+
+	_, err := db.c.Exec(`
+		UPDATE Receipts SET read_at = ?, delivered_at = COALESCE(delivered_at, ?)
+		WHERE user_id = ? AND read_at IS NULL AND message_id IN (
+			SELECT m.message_id
+			FROM Messages m
+			WHERE m.conversation_id = ? `+filter+`
+		)`, append([]interface{}{now, now, user_id, conversation_id}, args...)...)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.c.Exec(`
+		UPDATE Partecipants SET last_read_id = MAX(last_read_id, COALESCE((
+			SELECT MAX(message_id) FROM (
+				SELECT m.message_id
+				FROM Messages m
+				WHERE m.conversation_id = ? `+filter+`
+			) WHERE message_id IN (SELECT message_id FROM Messages WHERE thread_root_id IS NULL)
+		), 0))
+		WHERE user_id = ? AND conversation_id = ?`,
+		append(append([]interface{}{conversation_id}, args...), user_id, conversation_id)...)
+	return err
+}
+
+func (db *appdbimpl) SetLastRead(user_id int64, conversation_id int64, message_id int64) error {
+	isValid, err := db.CheckUserConversation(user_id, conversation_id)
+	if err != nil {
+		return err
+	}
+	if !isValid {
+		return errors.New("user is not a partecipant")
+	}
+
+	// 0 marks the whole conversation as unread
+	if message_id > 0 {
+		var exists bool
+		err = db.c.QueryRow(`
+			SELECT EXISTS(
+				SELECT 1
+				FROM Messages
+				WHERE conversation_id = ? AND message_id = ?
+			)`, conversation_id, message_id).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return errors.New(constants.MessageNotFound)
+		}
+
+		err = db.markRead(user_id, conversation_id, " AND m.message_id <= ?", message_id)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Unlike markRead the marker may move backwards, to mark the conversation as unread again
+	_, err = db.c.Exec(`UPDATE Partecipants SET last_read_id = ? WHERE user_id = ? AND conversation_id = ?`,
+		message_id, user_id, conversation_id)
+	return err
+}
+
+// getUnread fills the last read marker of the user in the preview and counts the messages received after it, and
+// those of them mentioning the user
+func (db *appdbimpl) getUnread(user_id int64, preview *models.Preview) error {
+	return db.c.QueryRow(`
+		SELECT p.last_read_id,
+		       COUNT(m.message_id),
+		       COALESCE(SUM(EXISTS (
+		           SELECT 1 FROM Mentions mn
+		           WHERE mn.message_id = m.message_id AND mn.comment_id = 0 AND mn.user_id = p.user_id
+		       )), 0)
+		FROM Partecipants p
+		LEFT JOIN Messages m ON m.conversation_id = p.conversation_id
+		                    AND m.message_id > p.last_read_id
+		                    AND m.user_id != p.user_id
+		                    AND m.deleted = 0
+		                    AND `+notHiddenCondition+`
+		                    AND `+notExpiredCondition()+`
+		                    `+timelineCondition+`
+		WHERE p.user_id = ? AND p.conversation_id = ?
+		GROUP BY p.last_read_id`,
+		user_id, user_id, preview.Conversation_id).Scan(&preview.LastReadId, &preview.UnreadCount, &preview.UnreadMentionCount)
+}
+
+func (db *appdbimpl) GetReceipts(user_id int64, conversation_id int64, message_id int64) ([]models.Receipt, error) {
+	receipts := make([]models.Receipt, 0)
+
+	isValid, err := db.CheckUserConversation(user_id, conversation_id)
+	if err != nil {
+		return receipts, err
+	}
+	if !isValid {
+		return receipts, errors.New("user is not a partecipant")
+	}
+
+	var exists bool
+	err = db.c.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1
+			FROM Messages
+			WHERE conversation_id = ? AND message_id = ?
+		)`, conversation_id, message_id).Scan(&exists)
+	if err != nil {
+		return receipts, err
+	}
+	if !exists {
+		return receipts, errors.New(constants.MessageNotFound)
+	}
+
+	rows, err := db.c.Query(`
+		SELECT user_id, delivered_at, read_at
+		FROM Receipts
+		WHERE message_id = ?
+		ORDER BY read_at IS NULL, read_at, delivered_at IS NULL, delivered_at`, message_id)
+	if err != nil {
+		return receipts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var receipt models.Receipt
+		var recipient_id int64
+
+		err = rows.Scan(&recipient_id, &receipt.DeliveredAt, &receipt.ReadAt)
+		if err != nil {
+			return receipts, err
+		}
+
+		receipt.User, err = db.GetUser(recipient_id)
+		if err != nil {
+			receipt.User.User_id = recipient_id
+			receipt.User.Username = "User"
+		}
+
+		receipts = append(receipts, receipt)
+	}
+	if rows.Err() != nil {
+		return receipts, rows.Err()
+	}
+
+	return receipts, nil
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+// statusOf returns the status of the message as seen by user_id
+func statusOf(t *testing.T, db AppDatabase, user_id int64, conversation_id int64, message_id int64) string {
+	t.Helper()
+
+	messages, err := db.(*appdbimpl).queryMessages(user_id, conversation_id, " AND m.message_id = ?", message_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("message %d not found", message_id)
+	}
+	return messages[0].Status
+}
+
+func TestReceiptsInGroup(t *testing.T) {
+	db := newTestDatabase(t)
+	setTime(t, 1700000000)
+
+	alice, bob, carol, conversation_id := newTestGroup(t, db)
+
+	message_id := sendText(t, db, alice, conversation_id, "Standup in 5")
+	if status := statusOf(t, db, alice, conversation_id, message_id); status != "sent" {
+		t.Errorf("new message: status %s, want sent", status)
+	}
+
+	// Delivered once every recipient's previews saw it
+	_, err := db.GetPreviewConversations(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := statusOf(t, db, alice, conversation_id, message_id); status != "sent" {
+		t.Errorf("message delivered to one of two: status %s, want sent", status)
+	}
+	_, err = db.GetPreviewConversations(carol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := statusOf(t, db, alice, conversation_id, message_id); status != "delivered" {
+		t.Errorf("message delivered to all: status %s, want delivered", status)
+	}
+
+	// Read once every recipient opened the conversation
+	setTime(t, 1700000060)
+	_, err = db.GetMessages(bob, conversation_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := statusOf(t, db, alice, conversation_id, message_id); status != "delivered" {
+		t.Errorf("message read by one of two: status %s, want delivered", status)
+	}
+
+	receipts, err := db.GetReceipts(alice, conversation_id, message_id)
+	if err != nil {
+		t.Fatalf("GetReceipts: %v", err)
+	}
+	if len(receipts) != 2 || receipts[0].User.User_id != bob || receipts[0].ReadAt == nil || *receipts[0].ReadAt != 1700000060 ||
+		receipts[1].User.User_id != carol || receipts[1].ReadAt != nil || receipts[1].DeliveredAt == nil {
+		t.Errorf("receipts %+v, want bob's read and carol's delivered only", receipts)
+	}
+
+	_, err = db.GetMessages(carol, conversation_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := statusOf(t, db, alice, conversation_id, message_id); status != "read" {
+		t.Errorf("message read by all: status %s, want read", status)
+	}
+}
+
+// previewOf returns the preview of the conversation for user_id
+func previewOf(t *testing.T, db AppDatabase, user_id int64, conversation_id int64) models.Preview {
+	t.Helper()
+
+	previews, err := db.GetPreviewConversations(user_id)
+	if err != nil {
+		t.Fatalf("GetPreviewConversations: %v", err)
+	}
+	for _, preview := range previews {
+		if preview.Conversation_id == conversation_id {
+			return preview
+		}
+	}
+	t.Fatalf("no preview of conversation %d", conversation_id)
+	return models.Preview{}
+}
+
+func TestUnreadCounters(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, conversation_id := newTestConversation(t, db)
+
+	sendText(t, db, alice, conversation_id, "Hi")
+	mention := sendText(t, db, alice, conversation_id, "@bob are you there?")
+	sendText(t, db, bob, conversation_id, "My own messages are never unread")
+	last := sendText(t, db, alice, conversation_id, "Ping")
+
+	preview := previewOf(t, db, bob, conversation_id)
+	if preview.UnreadCount != 3 || preview.UnreadMentionCount != 1 || preview.LastReadId != 0 {
+		t.Errorf("before reading: %d unread, %d mentions, last read %d, want 3, 1 and 0",
+			preview.UnreadCount, preview.UnreadMentionCount, preview.LastReadId)
+	}
+
+	err := db.SetLastRead(bob, conversation_id, mention)
+	if err != nil {
+		t.Fatalf("SetLastRead: %v", err)
+	}
+	preview = previewOf(t, db, bob, conversation_id)
+	if preview.UnreadCount != 1 || preview.UnreadMentionCount != 0 || preview.LastReadId != mention {
+		t.Errorf("read up to the mention: %d unread, %d mentions, last read %d, want 1, 0 and %d",
+			preview.UnreadCount, preview.UnreadMentionCount, preview.LastReadId, mention)
+	}
+
+	// Opening the conversation reads it all
+	_, err = db.GetMessages(bob, conversation_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preview = previewOf(t, db, bob, conversation_id)
+	if preview.UnreadCount != 0 || preview.LastReadId != last {
+		t.Errorf("after opening: %d unread, last read %d, want 0 and %d", preview.UnreadCount, preview.LastReadId, last)
+	}
+
+	// Marked unread again, everything counts again
+	err = db.SetLastRead(bob, conversation_id, 0)
+	if err != nil {
+		t.Fatalf("SetLastRead: %v", err)
+	}
+	preview = previewOf(t, db, bob, conversation_id)
+	if preview.UnreadCount != 3 || preview.UnreadMentionCount != 1 {
+		t.Errorf("marked unread: %d unread, %d mentions, want 3 and 1", preview.UnreadCount, preview.UnreadMentionCount)
+	}
+
+	err = db.SetLastRead(bob, conversation_id, last+100)
+	if err == nil || err.Error() != constants.MessageNotFound {
+		t.Errorf("marker on a missing message: %v, want %s", err, constants.MessageNotFound)
+	}
+}
@@ -0,0 +1,205 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+func (db *appdbimpl) CreateScheduledMessage(user_id int64, conversation_id int64, typeMessage string, content string, media []byte, send_at int64) (models.ScheduledMessage, error) {
+	scheduled := models.ScheduledMessage{
+		Conversation_id: conversation_id,
+		Sender_id:       user_id,
+		Type:            typeMessage,
+		Content:         content,
+		Media:           media,
+		SendAt:          send_at,
+		CreatedAt:       globaltime.Now().Unix(),
+	}
+
+	isValid, err := db.CheckUserConversation(user_id, conversation_id)
+	if err != nil {
+		return scheduled, err
+	}
+	if !isValid {
+		return scheduled, errors.New("user is not a partecipant")
+	}
+
+	err = db.c.QueryRow(`
+		INSERT INTO ScheduledMessages (conversation_id, user_id, type, content, media, send_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING scheduled_id;`,
+		conversation_id, user_id, typeMessage, content, media, send_at, scheduled.CreatedAt).Scan(&scheduled.Scheduled_id)
+	if err != nil {
+		return scheduled, err
+	}
+
+	return scheduled, nil
+}
+
+func (db *appdbimpl) GetScheduledMessages(user_id int64, conversation_id int64) ([]models.ScheduledMessage, error) {
+	scheduled := make([]models.ScheduledMessage, 0)
+
+	isValid, err := db.CheckUserConversation(user_id, conversation_id)
+	if err != nil {
+		return scheduled, err
+	}
+	if !isValid {
+		return scheduled, errors.New("user is not a partecipant")
+	}
+
+	rows, err := db.c.Query(`
+		SELECT scheduled_id, conversation_id, user_id, type, COALESCE(content, ''), media, send_at, created_at
+		FROM ScheduledMessages
+		WHERE user_id = ? AND conversation_id = ?
+		ORDER BY send_at, scheduled_id`,
+		user_id, conversation_id)
+	if err != nil {
+		return scheduled, err
+	}
+
+	return scanScheduledMessages(rows)
+}
+
+func (db *appdbimpl) UpdateScheduledMessage(user_id int64, conversation_id int64, scheduled_id int64, typeMessage string, content string, media []byte, send_at int64) (models.ScheduledMessage, error) {
+	var scheduled models.ScheduledMessage
+
+	isValid, err := db.CheckUserConversation(user_id, conversation_id)
+	if err != nil {
+		return scheduled, err
+	}
+	if !isValid {
+		return scheduled, errors.New("user is not a partecipant")
+	}
+
+	err = db.c.QueryRow(`
+		UPDATE ScheduledMessages SET type = ?, content = ?, media = ?, send_at = ?
+		WHERE scheduled_id = ? AND user_id = ? AND conversation_id = ?
+		RETURNING scheduled_id, conversation_id, user_id, type, COALESCE(content, ''), media, send_at, created_at;`,
+		typeMessage, content, media, send_at, scheduled_id, user_id, conversation_id).Scan(
+		&scheduled.Scheduled_id,
+		&scheduled.Conversation_id,
+		&scheduled.Sender_id,
+		&scheduled.Type,
+		&scheduled.Content,
+		&scheduled.Media,
+		&scheduled.SendAt,
+		&scheduled.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return scheduled, errors.New(constants.ScheduledMessageNotFound)
+		}
+		return scheduled, err
+	}
+
+	return scheduled, nil
+}
+
+func (db *appdbimpl) DeleteScheduledMessage(user_id int64, conversation_id int64, scheduled_id int64) error {
+	res, err := db.c.Exec(`DELETE FROM ScheduledMessages WHERE scheduled_id = ? AND user_id = ? AND conversation_id = ?`,
+		scheduled_id, user_id, conversation_id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New(constants.ScheduledMessageNotFound)
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) GetDueScheduledMessages(now int64) ([]models.ScheduledMessage, error) {
+	rows, err := db.c.Query(`
+		SELECT scheduled_id, conversation_id, user_id, type, COALESCE(content, ''), media, send_at, created_at
+		FROM ScheduledMessages
+		WHERE send_at <= ?
+		ORDER BY send_at, scheduled_id;`, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanScheduledMessages(rows)
+}
+
+// The message is claimed by removing it before sending it, so it is sent once, with its latest content, even if the
+// user edits or cancels it meanwhile. A message whose sender left the conversation is removed without being sent.
+func (db *appdbimpl) SendScheduledMessage(scheduled_id int64, now int64) (models.Message, error) {
+	var scheduled models.ScheduledMessage
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	err = tx.QueryRow(`
+		DELETE FROM ScheduledMessages WHERE scheduled_id = ? AND send_at <= ?
+		RETURNING conversation_id, user_id, type, COALESCE(content, ''), media;`,
+		scheduled_id, now).Scan(
+		&scheduled.Conversation_id,
+		&scheduled.Sender_id,
+		&scheduled.Type,
+		&scheduled.Content,
+		&scheduled.Media,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Message{}, errors.New(constants.ScheduledMessageNotFound)
+		}
+		return models.Message{}, err
+	}
+
+	message, err := db.insertMessage(tx, scheduled.Sender_id, scheduled.Conversation_id, 0, scheduled.Type, scheduled.Content, scheduled.Media, false, "")
+	if err != nil && err.Error() == constants.NotPartecipant {
+		commitErr := tx.Commit()
+		if commitErr != nil {
+			return message, commitErr
+		}
+		return message, err
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	return message, tx.Commit()
+}
+
+// scanScheduledMessages reads and closes rows of ScheduledMessages columns
+func scanScheduledMessages(rows *sql.Rows) ([]models.ScheduledMessage, error) {
+	scheduled := make([]models.ScheduledMessage, 0)
+	defer rows.Close()
+
+	for rows.Next() {
+		var message models.ScheduledMessage
+
+		err := rows.Scan(
+			&message.Scheduled_id,
+			&message.Conversation_id,
+			&message.Sender_id,
+			&message.Type,
+			&message.Content,
+			&message.Media,
+			&message.SendAt,
+			&message.CreatedAt,
+		)
+		if err != nil {
+			return scheduled, err
+		}
+
+		scheduled = append(scheduled, message)
+	}
+	if rows.Err() != nil {
+		return scheduled, rows.Err()
+	}
+
+	return scheduled, nil
+}
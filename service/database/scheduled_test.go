@@ -0,0 +1,86 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/maisto1/WasaText/service/constants"
+)
+
+func TestSendScheduledMessageOnce(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, _, conversation_id := newTestConversation(t, db)
+	setTime(t, 1700000000)
+
+	scheduled, err := db.CreateScheduledMessage(alice, conversation_id, "text", "Happy birthday!", nil, 1700000060)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.SendScheduledMessage(scheduled.Scheduled_id, 1700000059)
+	if err == nil || err.Error() != constants.ScheduledMessageNotFound {
+		t.Fatalf("SendScheduledMessage before its time returned %v", err)
+	}
+
+	// The latest content is sent
+	_, err = db.UpdateScheduledMessage(alice, conversation_id, scheduled.Scheduled_id, "text", "Happy birthday Bob!", nil, 1700000060)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message, err := db.SendScheduledMessage(scheduled.Scheduled_id, 1700000060)
+	if err != nil {
+		t.Fatalf("SendScheduledMessage: %v", err)
+	}
+	if message.Content != "Happy birthday Bob!" {
+		t.Errorf("sent %q, want the edited content", message.Content)
+	}
+
+	_, err = db.SendScheduledMessage(scheduled.Scheduled_id, 1700000060)
+	if err == nil || err.Error() != constants.ScheduledMessageNotFound {
+		t.Errorf("second send returned %v, want %q", err, constants.ScheduledMessageNotFound)
+	}
+	if count := countRows(t, db, "Messages"); count != 1 {
+		t.Errorf("%d messages sent, want 1", count)
+	}
+
+	// Once sent, the message can't be cancelled anymore
+	err = db.DeleteScheduledMessage(alice, conversation_id, scheduled.Scheduled_id)
+	if err == nil || err.Error() != constants.ScheduledMessageNotFound {
+		t.Errorf("cancel after the send returned %v, want %q", err, constants.ScheduledMessageNotFound)
+	}
+}
+
+func TestSendScheduledMessageDropsMessagesOfLeavers(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, _ := newTestConversation(t, db)
+	setTime(t, 1700000000)
+
+	group_id, err := db.CreateConversation(alice, "Team", "group", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AddGroup(alice, "bob", int64(group_id))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scheduled, err := db.CreateScheduledMessage(bob, int64(group_id), "text", "See you tomorrow", nil, 1700000060)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.RemoveGroup(bob, int64(group_id), bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.SendScheduledMessage(scheduled.Scheduled_id, 1700000060)
+	if err == nil || err.Error() != constants.NotPartecipant {
+		t.Fatalf("SendScheduledMessage of a leaver returned %v, want %q", err, constants.NotPartecipant)
+	}
+	if count := countRows(t, db, "ScheduledMessages"); count != 0 {
+		t.Errorf("%d scheduled messages left, want the message of the leaver dropped", count)
+	}
+	if count := countRows(t, db, "Messages"); count != 0 {
+		t.Errorf("%d messages sent by the leaver", count)
+	}
+}
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"html"
+	"strings"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+// setupSearch builds the full-text index and its triggers, and tells whether search is available. SQLite has FTS5
+// only when built with the sqlite_fts5 tag: without it search is disabled, but the rest of the database works.
+func setupSearch(db *sql.DB) (bool, error) {
+	var available bool
+	err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5');`).Scan(&available)
+	if err != nil {
+		return false, errors.New("error checking full-text search support")
+	}
+
+	// The triggers of a database indexed by a build with FTS5 would make every write fail. They are dropped, and
+	// the stale index is rebuilt once search is available again.
+	if !available {
+		for triggerName := range searchTriggerCreationStatements {
+			_, err = db.Exec(`DROP TRIGGER IF EXISTS "` + triggerName + `";`)
+			if err != nil {
+				return false, errors.New("error dropping trigger " + triggerName)
+			}
+		}
+		return false, nil
+	}
+
+	var indexed bool
+	err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type='trigger' AND name='messages_search_insert');`).Scan(&indexed)
+	if err != nil {
+		return false, errors.New("error checking search triggers")
+	}
+
+	for tableName, tableCreationStatement := range searchTablesCreationStatements {
+		err = db.QueryRow(`SELECT name FROM sqlite_master WHERE type='table' AND name= ? ;`, tableName).Scan(&tableName)
+		if errors.Is(err, sql.ErrNoRows) {
+			_, err = db.Exec(tableCreationStatement)
+			if err != nil {
+				return false, errors.New("error building table " + tableName)
+			}
+		} else if err != nil {
+			return false, errors.New("error checking table " + tableName)
+		} else if indexed {
+			continue
+		}
+
+		_, err = db.Exec(`DELETE FROM "` + tableName + `";`)
+		if err == nil {
+			_, err = db.Exec(searchBackfillStatements[tableName])
+		}
+		if err != nil {
+			return false, errors.New("error indexing table " + tableName)
+		}
+	}
+
+	for triggerName, triggerCreationStatement := range searchTriggerCreationStatements {
+		_, err = db.Exec(triggerCreationStatement)
+		if err != nil {
+			return false, errors.New("error building trigger " + triggerName)
+		}
+	}
+
+	return true, nil
+}
+
+// matchQuery turns the words of text into an FTS5 query matching all of them, quoting each one so that the FTS5
+// syntax can't be injected
+func matchQuery(text string) string {
+	words := strings.Fields(text)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	return strings.Join(words, " ")
+}
+
+func (db *appdbimpl) SearchAvailable() bool {
+	return db.search
+}
+
+// The snippets are marked with control characters, replaced by <mark> tags once the text is escaped
+const (
+	snippetMatchStart = "\x02"
+	snippetMatchEnd   = "\x03"
+)
+
+func (db *appdbimpl) SearchMessages(user_id int64, filter models.SearchFilter) ([]models.SearchHit, error) {
+	hits := make([]models.SearchHit, 0)
+
+	if !db.search {
+		return hits, errors.New(constants.SearchUnavailable)
+	}
+
+	if filter.Conversation_id > 0 {
+		isValid, err := db.CheckUserConversation(user_id, filter.Conversation_id)
+		if err != nil {
+			return hits, err
+		}
+		if !isValid {
+			return hits, errors.New("user is not a partecipant")
+		}
+	}
+
+	match := matchQuery(filter.Text)
+	args := make([]interface{}, 0)
+
+	// conditions filters the hits of one of the search tables: m is the message, u the author of the hit and
+	// timestamp the column holding when it was written
+	conditions := func(timestamp string) string {
+		args = append(args, user_id, match, user_id)
+
+		filters := ` AND m.deleted = 0 AND ` + notHiddenCondition + ` AND ` + notExpiredCondition()
+		if filter.Conversation_id > 0 {
+			filters += ` AND m.conversation_id = ?`
+			args = append(args, filter.Conversation_id)
+		}
+		if filter.Sender != "" {
+			filters += ` AND u.username = ?`
+			args = append(args, filter.Sender)
+		}
+		if filter.Type != "" {
+			filters += ` AND m.type = ?`
+			args = append(args, filter.Type)
+		}
+		if filter.From > 0 {
+			filters += ` AND ` + timestamp + ` >= ?`
+			args = append(args, filter.From)
+		}
+		if filter.To > 0 {
+			filters += ` AND ` + timestamp + ` <= ?`
+			args = append(args, filter.To)
+		}
+		return filters
+	}
+
+	message_conditions := conditions("m.timestamp")
+	comment_conditions := conditions("c.timestamp")
+	args = append(args, filter.Limit)
+
+	rows, err := db.c.Query(`
+		SELECT conversation_id, message_id, comment_id, thread_root_id, author_id, type, snippet, hit_timestamp
+		FROM (
+			SELECT m.conversation_id, m.message_id, NULL AS comment_id, m.thread_root_id, m.user_id AS author_id, m.type,
+			       snippet("MessagesSearch", 0, char(2), char(3), '…', 12) AS snippet,
+			       m.timestamp AS hit_timestamp, bm25("MessagesSearch") AS rank
+			FROM "MessagesSearch"
+			JOIN Messages m ON m.message_id = "MessagesSearch".rowid
+			JOIN Partecipants p ON p.conversation_id = m.conversation_id AND p.user_id = ?
+			JOIN Users u ON u.user_id = m.user_id
+			WHERE "MessagesSearch" MATCH ?`+message_conditions+`
+			UNION ALL
+			SELECT m.conversation_id, m.message_id, c.comment_id, m.thread_root_id, c.user_id, m.type,
+			       snippet("CommentsSearch", 0, char(2), char(3), '…', 12),
+			       c.timestamp, bm25("CommentsSearch")
+			FROM "CommentsSearch"
+			JOIN Comments c ON c.comment_id = "CommentsSearch".rowid
+			JOIN Messages m ON m.message_id = c.message_id
+			JOIN Partecipants p ON p.conversation_id = m.conversation_id AND p.user_id = ?
+			JOIN Users u ON u.user_id = c.user_id
+			WHERE "CommentsSearch" MATCH ?`+comment_conditions+`
+		)
+		ORDER BY rank, hit_timestamp DESC
+		LIMIT ?`, args...)
+	if err != nil {
+		return hits, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hit models.SearchHit
+		var author_id int64
+		var snippet string
+
+		err = rows.Scan(&hit.Conversation_id, &hit.Message_id, &hit.Comment_id, &hit.ThreadRootId, &author_id, &hit.Type, &snippet, &hit.Timestamp)
+		if err != nil {
+			return hits, err
+		}
+
+		snippet = html.EscapeString(snippet)
+		snippet = strings.ReplaceAll(snippet, snippetMatchStart, "<mark>")
+		hit.Snippet = strings.ReplaceAll(snippet, snippetMatchEnd, "</mark>")
+
+		hit.Sender, err = db.GetUser(author_id)
+		if err != nil {
+			return hits, err
+		}
+
+		hits = append(hits, hit)
+	}
+
+	if rows.Err() != nil {
+		return hits, rows.Err()
+	}
+
+	return hits, nil
+}
@@ -0,0 +1,160 @@
+//go:build sqlite_fts5
+
+package database
+
+import (
+	"testing"
+
+	"github.com/maisto1/WasaText/service/models"
+)
+
+// search returns the ids of the messages found by filter for the user, failing the test on error
+func search(t *testing.T, db AppDatabase, user_id int64, filter models.SearchFilter) []int64 {
+	filter.Limit = 50
+	hits, err := db.SearchMessages(user_id, filter)
+	if err != nil {
+		t.Fatalf("SearchMessages(%q): %v", filter.Text, err)
+	}
+
+	message_ids := make([]int64, 0, len(hits))
+	for _, hit := range hits {
+		message_ids = append(message_ids, hit.Message_id)
+	}
+	return message_ids
+}
+
+func TestSearchFollowsMessages(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, conversation_id := newTestConversation(t, db)
+	if !db.SearchAvailable() {
+		t.Fatal("search unavailable although built with sqlite_fts5")
+	}
+	setTime(t, 1700000000)
+
+	message_id := sendText(t, db, alice, conversation_id, "Pizza tonight?")
+	if found := search(t, db, bob, models.SearchFilter{Text: "pizza"}); len(found) != 1 || found[0] != message_id {
+		t.Fatalf("new message: found %v, want [%d]", found, message_id)
+	}
+
+	_, err := db.EditMessage(alice, conversation_id, message_id, "Sushi tonight?", 0)
+	if err != nil {
+		t.Fatalf("EditMessage: %v", err)
+	}
+	if found := search(t, db, bob, models.SearchFilter{Text: "pizza"}); len(found) != 0 {
+		t.Errorf("edited message still found by its old content: %v", found)
+	}
+	if found := search(t, db, bob, models.SearchFilter{Text: "sushi"}); len(found) != 1 {
+		t.Errorf("edited message not found by its new content: %v", found)
+	}
+
+	// The tombstone isn't found, until the message is restored
+	err = db.DeleteMessage(alice, conversation_id, message_id)
+	if err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	if found := search(t, db, bob, models.SearchFilter{Text: "sushi"}); len(found) != 0 {
+		t.Errorf("deleted message found: %v", found)
+	}
+	err = db.RestoreMessage(alice, conversation_id, message_id, 0)
+	if err != nil {
+		t.Fatalf("RestoreMessage: %v", err)
+	}
+	if found := search(t, db, bob, models.SearchFilter{Text: "sushi"}); len(found) != 1 {
+		t.Errorf("restored message not found: %v", found)
+	}
+
+	// Once purged, nothing is left in the index
+	err = db.DeleteMessage(alice, conversation_id, message_id)
+	if err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	_, err = db.PurgeDeletedMessages(1700000001)
+	if err != nil {
+		t.Fatalf("PurgeDeletedMessages: %v", err)
+	}
+	if count := countRows(t, db, "MessagesSearch"); count != 0 {
+		t.Errorf("%d rows left in the index after the purge", count)
+	}
+}
+
+func TestSearchFollowsComments(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, conversation_id := newTestConversation(t, db)
+	message_id := sendText(t, db, alice, conversation_id, "Dinner?")
+
+	comment, err := db.CreateComment(bob, conversation_id, message_id, "Pizza please", "")
+	if err != nil {
+		t.Fatalf("CreateComment: %v", err)
+	}
+
+	hits, err := db.SearchMessages(alice, models.SearchFilter{Text: "pizza", Limit: 10})
+	if err != nil {
+		t.Fatalf("SearchMessages: %v", err)
+	}
+	if len(hits) != 1 || hits[0].Comment_id == nil || *hits[0].Comment_id != comment.Comment_id || hits[0].Message_id != message_id {
+		t.Fatalf("comment search: got %+v", hits)
+	}
+	if hits[0].Snippet != "<mark>Pizza</mark> please" {
+		t.Errorf("snippet %q", hits[0].Snippet)
+	}
+
+	err = db.DeleteComment(bob, conversation_id, comment.Comment_id)
+	if err != nil {
+		t.Fatalf("DeleteComment: %v", err)
+	}
+	if found := search(t, db, alice, models.SearchFilter{Text: "pizza"}); len(found) != 0 {
+		t.Errorf("deleted comment found: %v", found)
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, conversation_id := newTestConversation(t, db)
+	carol, err := db.Login("carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other_id, err := db.CreateConversation(alice, "", "private", "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setTime(t, 1700000000)
+	early := sendText(t, db, alice, conversation_id, "meeting at noon")
+	setTime(t, 1700000100)
+	late := sendText(t, db, bob, conversation_id, "meeting moved")
+	setTime(t, 1700000200)
+	elsewhere := sendText(t, db, carol, int64(other_id), "meeting tomorrow")
+
+	cases := []struct {
+		name   string
+		filter models.SearchFilter
+		want   []int64
+	}{
+		{"conversation", models.SearchFilter{Text: "meeting", Conversation_id: conversation_id}, []int64{early, late}},
+		{"sender", models.SearchFilter{Text: "meeting", Sender: "bob"}, []int64{late}},
+		{"from", models.SearchFilter{Text: "meeting", From: 1700000100}, []int64{late, elsewhere}},
+		{"to", models.SearchFilter{Text: "meeting", To: 1700000099}, []int64{early}},
+		{"from and to", models.SearchFilter{Text: "meeting", From: 1700000050, To: 1700000150}, []int64{late}},
+	}
+
+	for _, c := range cases {
+		found := search(t, db, alice, c.filter)
+		got := make(map[int64]bool, len(found))
+		for _, message_id := range found {
+			got[message_id] = true
+		}
+		ok := len(found) == len(c.want)
+		for _, message_id := range c.want {
+			ok = ok && got[message_id]
+		}
+		if !ok {
+			t.Errorf("%s filter: found %v, want %v", c.name, found, c.want)
+		}
+	}
+
+	// Only the conversations of the user are searched
+	if found := search(t, db, bob, models.SearchFilter{Text: "tomorrow"}); len(found) != 0 {
+		t.Errorf("bob found messages of a conversation of others: %v", found)
+	}
+}
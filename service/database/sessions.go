@@ -0,0 +1,171 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+func (db *appdbimpl) CreateSession(user_id int64, token_hash string, expires_at int64, user_agent string, remote_ip string) (models.Session, error) {
+	var session models.Session
+	current_time := globaltime.Now().Unix()
+
+	err := db.c.QueryRow(`
+		INSERT INTO Sessions (user_id, token_hash, created_at, expires_at, last_used_at, user_agent, remote_ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING session_id;`,
+		user_id,
+		token_hash,
+		current_time,
+		expires_at,
+		current_time,
+		user_agent,
+		remote_ip,
+	).Scan(&session.Session_id)
+	if err != nil {
+		return session, err
+	}
+
+	session.User_id = user_id
+	session.CreatedAt = current_time
+	session.LastUsedAt = current_time
+	session.ExpiresAt = expires_at
+	session.UserAgent = user_agent
+	session.RemoteIP = remote_ip
+
+	return session, nil
+}
+
+// Expired sessions are removed as soon as they are presented
+func (db *appdbimpl) GetSession(token_hash string) (models.Session, error) {
+	var session models.Session
+
+	err := db.c.QueryRow(`
+		SELECT session_id, user_id, created_at, COALESCE(last_used_at, created_at), expires_at,
+		       COALESCE(user_agent, ''), COALESCE(remote_ip, '')
+		FROM Sessions
+		WHERE token_hash = ?`,
+		token_hash,
+	).Scan(
+		&session.Session_id,
+		&session.User_id,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&session.UserAgent,
+		&session.RemoteIP,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return session, errors.New(constants.SessionNotFound)
+	}
+	if err != nil {
+		return session, err
+	}
+
+	if session.ExpiresAt <= globaltime.Now().Unix() {
+		err = db.DeleteSession(session.Session_id)
+		if err != nil {
+			return session, err
+		}
+		return session, errors.New(constants.SessionExpired)
+	}
+
+	return session, nil
+}
+
+func (db *appdbimpl) TouchSession(session_id int64, remote_ip string) error {
+	_, err := db.c.Exec("UPDATE Sessions SET last_used_at = ?, remote_ip = ? WHERE session_id = ?;", globaltime.Now().Unix(), remote_ip, session_id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) GetSessions(user_id int64) ([]models.Session, error) {
+	sessions := make([]models.Session, 0)
+
+	rows, err := db.c.Query(`
+		SELECT session_id, created_at, COALESCE(last_used_at, created_at), expires_at,
+		       COALESCE(user_agent, ''), COALESCE(remote_ip, '')
+		FROM Sessions
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY COALESCE(last_used_at, created_at) DESC, session_id DESC`,
+		user_id, globaltime.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var session models.Session
+
+		err = rows.Scan(
+			&session.Session_id,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+			&session.UserAgent,
+			&session.RemoteIP,
+		)
+		if err != nil {
+			return nil, err
+		}
+		session.User_id = user_id
+
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (db *appdbimpl) DeleteSession(session_id int64) error {
+	_, err := db.c.Exec("DELETE FROM Sessions WHERE session_id = ?;", session_id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) RevokeSession(user_id int64, session_id int64) error {
+	res, err := db.c.Exec("DELETE FROM Sessions WHERE user_id = ? AND session_id = ?;", user_id, session_id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New(constants.SessionNotFound)
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) RevokeSessions(user_id int64) error {
+	_, err := db.c.Exec("DELETE FROM Sessions WHERE user_id = ?;", user_id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) DeleteExpiredSessions(now int64) (int, error) {
+	res, err := db.c.Exec("DELETE FROM Sessions WHERE expires_at <= ?;", now)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := res.RowsAffected()
+	return int(deleted), err
+}
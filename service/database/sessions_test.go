@@ -0,0 +1,45 @@
+package database
+
+import "testing"
+
+func TestDeleteExpiredSessions(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, _ := newTestConversation(t, db)
+	setTime(t, 1700000000)
+
+	_, err := db.CreateSession(alice, "expired", 1700000000, "phone", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateSession(alice, "valid", 1700003600, "laptop", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateSession(bob, "other", 1700003600, "phone", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := db.DeleteExpiredSessions(1700000000)
+	if err != nil {
+		t.Fatalf("DeleteExpiredSessions: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("DeleteExpiredSessions deleted %d sessions, want 1", deleted)
+	}
+
+	err = db.RevokeSessions(alice)
+	if err != nil {
+		t.Fatalf("RevokeSessions: %v", err)
+	}
+	sessions, err := db.GetSessions(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("%d sessions left after revoking them all", len(sessions))
+	}
+	if count := countRows(t, db, "Sessions"); count != 1 {
+		t.Errorf("%d sessions left, want the one of the other user", count)
+	}
+}
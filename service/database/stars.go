@@ -0,0 +1,102 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+func (db *appdbimpl) StarMessage(user_id int64, conversation_id int64, message_id int64) error {
+	err := db.checkVisibleMessage(user_id, conversation_id, message_id)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.c.Exec(`INSERT OR IGNORE INTO Stars (user_id, message_id, timestamp) VALUES (?, ?, ?)`,
+		user_id, message_id, globaltime.Now().Unix())
+	return err
+}
+
+func (db *appdbimpl) UnstarMessage(user_id int64, conversation_id int64, message_id int64) error {
+	isValid, err := db.CheckUserConversation(user_id, conversation_id)
+	if err != nil {
+		return err
+	}
+	if !isValid {
+		return errors.New("user is not a partecipant")
+	}
+
+	_, err = db.c.Exec(`
+		DELETE FROM Stars
+		WHERE user_id = ? AND message_id IN (SELECT message_id FROM Messages WHERE message_id = ? AND conversation_id = ?)`,
+		user_id, message_id, conversation_id)
+	return err
+}
+
+func (db *appdbimpl) GetStarredMessages(user_id int64, before int64, limit int) (models.StarredPage, error) {
+	page := models.StarredPage{Messages: make([]models.StarredMessage, 0)}
+
+	filter := ""
+	args := []interface{}{user_id, user_id, user_id, user_id}
+	if before > 0 {
+		filter = " AND s.star_id < ?"
+		args = append(args, before)
+	}
+
+	// Messages deleted, hidden or expired, and those of conversations the user left, aren't listed. One more star
+	// than requested tells whether there is an older page.
+	rows, err := db.c.Query(`
+		WITH `+otherUserTable+`
+		SELECT s.star_id, s.timestamp, m.conversation_id, m.message_id,
+		       `+conversationNameColumns+`
+		FROM Stars s
+		JOIN Messages m ON m.message_id = s.message_id
+		JOIN Conversations c ON c.conversation_id = m.conversation_id
+		JOIN Partecipants p ON p.conversation_id = c.conversation_id AND p.user_id = s.user_id
+		LEFT JOIN OtherUser o ON o.conversation_id = c.conversation_id AND c.conversation_type = 'private'
+		WHERE s.user_id = ? AND m.deleted = 0 AND `+notHiddenCondition+` AND `+notExpiredCondition()+filter+`
+		ORDER BY s.star_id DESC
+		LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		return page, err
+	}
+
+	for rows.Next() {
+		var starred models.StarredMessage
+
+		err = rows.Scan(&starred.Star_id, &starred.StarredAt, &starred.Conversation_id, &starred.Message.Message_id,
+			&starred.ConversationName, &starred.ConversationPhoto)
+		if err != nil {
+			rows.Close()
+			return page, err
+		}
+
+		page.Messages = append(page.Messages, starred)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return page, rows.Err()
+	}
+
+	if len(page.Messages) > limit {
+		page.Messages = page.Messages[:limit]
+		page.OlderCursor = &page.Messages[limit-1].Star_id
+	}
+
+	for i := range page.Messages {
+		starred := &page.Messages[i]
+
+		messages, err := db.queryMessages(user_id, starred.Conversation_id, " AND m.message_id = ?", starred.Message.Message_id)
+		if err != nil {
+			return page, err
+		}
+		if len(messages) == 0 {
+			return page, errors.New(constants.MessageNotFound)
+		}
+		starred.Message = messages[0]
+	}
+
+	return page, nil
+}
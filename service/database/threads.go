@@ -0,0 +1,216 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+// maxThreadParticipants is how many of the users who replied in a thread its summary shows
+const maxThreadParticipants = 5
+
+func (db *appdbimpl) CreateThreadReply(user_id int64, conversation_id int64, root_id int64, typeMessage string, content string, media []byte, client_message_id string) (models.Message, error) {
+	var message models.Message
+	var message_id int64
+
+	current_time := globaltime.Now().Unix()
+
+	isValid, err := db.CheckUserConversation(user_id, conversation_id)
+	if err != nil {
+		return message, err
+	}
+	if !isValid {
+		return message, errors.New("user is not a partecipant")
+	}
+
+	err = db.checkClientId("Messages", user_id, client_message_id)
+	if err != nil {
+		return message, err
+	}
+
+	// Threads don't nest: replying to a reply in a thread replies in the same thread
+	err = db.c.QueryRow(`
+		SELECT COALESCE(m.thread_root_id, m.message_id)
+		FROM Messages m
+		WHERE m.message_id = ? AND m.conversation_id = ? AND m.deleted = 0 AND m.type != 'system'
+		      AND `+notHiddenCondition+` AND `+notExpiredCondition(),
+		root_id, conversation_id, user_id).Scan(&root_id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return message, errors.New(constants.MessageNotFound)
+		}
+		return message, err
+	}
+
+	var root_sender_id int64
+	err = db.c.QueryRow(`SELECT user_id FROM Messages WHERE message_id = ?`, root_id).Scan(&root_sender_id)
+	if err != nil {
+		return message, err
+	}
+
+	expires_at, err := db.messageExpiry(conversation_id, current_time)
+	if err != nil {
+		return message, err
+	}
+
+	// The reply is stored with its receipts, mentions and inbox items, or not at all
+	tx, err := db.c.Begin()
+	if err != nil {
+		return message, err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO Messages (conversation_id, user_id, content, media, type, timestamp, status, isForwarded, thread_root_id, expires_at, client_message_id)
+		VALUES (?, ?, ?, ?, ?, ?, 'sent', 0, ?, ?, ?) ON CONFLICT DO NOTHING RETURNING message_id;`,
+		conversation_id,
+		user_id,
+		content,
+		media,
+		typeMessage,
+		current_time,
+		root_id,
+		expires_at,
+		nullableClientId(client_message_id),
+	).Scan(&message_id)
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = tx.Rollback()
+		return message, errors.New(constants.DuplicateClientMessageId)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	err = createReceipts(tx, message_id, conversation_id, user_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	_, err = db.recordMentions(tx, conversation_id, message_id, 0, user_id, content, current_time)
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	if root_sender_id != user_id {
+		err = addInboxItem(tx, root_sender_id, conversation_id, message_id, 0, "thread", current_time)
+		if err != nil {
+			_ = tx.Rollback()
+			return message, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return message, err
+	}
+
+	messages, err := db.queryMessages(user_id, conversation_id, " AND m.message_id = ?", message_id)
+	if err != nil {
+		return message, err
+	}
+	if len(messages) == 0 {
+		return message, errors.New(constants.MessageNotFound)
+	}
+
+	return messages[0], nil
+}
+
+func (db *appdbimpl) GetThread(user_id int64, conversation_id int64, root_id int64, before int64, after int64, limit int) (models.Thread, error) {
+	var thread models.Thread
+
+	isValid, err := db.CheckUserConversation(user_id, conversation_id)
+	if err != nil {
+		return thread, err
+	}
+	if !isValid {
+		return thread, errors.New("user is not a partecipant")
+	}
+
+	// The thread of a deleted message is still readable, under its tombstone
+	roots, err := db.queryMessages(user_id, conversation_id, timelineCondition+" AND m.message_id = ?", root_id)
+	if err != nil {
+		return thread, err
+	}
+	if len(roots) == 0 {
+		return thread, errors.New(constants.MessageNotFound)
+	}
+
+	page, err := db.readPage(user_id, conversation_id, " AND m.thread_root_id = ?", []interface{}{root_id}, before, after, limit)
+	if err != nil {
+		return thread, err
+	}
+
+	thread.Root = roots[0]
+	thread.Replies = page.Messages
+	thread.OlderCursor = page.OlderCursor
+	thread.NewerCursor = page.NewerCursor
+
+	return thread, nil
+}
+
+// fillThreads sets the thread summary of the messages in the timeline with replies visible to user_id
+func (db *appdbimpl) fillThreads(user_id int64, messages []models.Message) error {
+	positions := make(map[int64]int, len(messages))
+	message_ids := make([]interface{}, 0, len(messages))
+
+	for i := range messages {
+		if messages[i].ThreadRootId != nil {
+			continue
+		}
+		positions[messages[i].Message_id] = i
+		message_ids = append(message_ids, messages[i].Message_id)
+	}
+
+	return forEachBatch(message_ids, func(placeholders string, batch []interface{}) error {
+		// A row per user who replied in each thread, the latest first
+		rows, err := db.c.Query(`
+			SELECT m.thread_root_id, m.user_id, COUNT(*), MAX(m.timestamp)
+			FROM Messages m
+			WHERE m.thread_root_id IN (`+placeholders+`) AND m.deleted = 0
+			      AND `+notHiddenCondition+` AND `+notExpiredCondition()+`
+			GROUP BY m.thread_root_id, m.user_id
+			ORDER BY m.thread_root_id, MAX(m.timestamp) DESC, MAX(m.message_id) DESC`, append(batch, user_id)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var root_id int64
+			var replier_id int64
+			var replies int
+			var last_reply_at int64
+
+			err = rows.Scan(&root_id, &replier_id, &replies, &last_reply_at)
+			if err != nil {
+				return err
+			}
+
+			message := &messages[positions[root_id]]
+			if message.Thread == nil {
+				message.Thread = &models.ThreadSummary{Participants: make([]models.User, 0, maxThreadParticipants)}
+			}
+
+			message.Thread.ReplyCount += replies
+			if last_reply_at > message.Thread.LastReplyAt {
+				message.Thread.LastReplyAt = last_reply_at
+			}
+
+			if len(message.Thread.Participants) < maxThreadParticipants {
+				replier, err := db.GetUser(replier_id)
+				if err != nil {
+					replier.User_id = replier_id
+					replier.Username = "User"
+				}
+				message.Thread.Participants = append(message.Thread.Participants, replier)
+			}
+		}
+
+		return rows.Err()
+	})
+}
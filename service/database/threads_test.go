@@ -0,0 +1,40 @@
+package database
+
+import "testing"
+
+func TestCreateThreadReplyStoresNothingOnFailure(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, conversation_id := newTestConversation(t, db)
+	root_id := sendText(t, db, bob, conversation_id, "Who's coming tonight?")
+
+	_, err := db.(*appdbimpl).c.Exec(`
+		CREATE TRIGGER fail_inbox BEFORE INSERT ON InboxItems
+		BEGIN SELECT RAISE(ABORT, 'inbox refused'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.CreateThreadReply(alice, conversation_id, root_id, "text", "Me", nil, "reply-1")
+	if err == nil {
+		t.Fatal("CreateThreadReply succeeded although the inbox item couldn't be stored")
+	}
+	if count := countRows(t, db, "Messages"); count != 1 {
+		t.Errorf("%d messages after the failed reply, want only the root", count)
+	}
+
+	// The retry with the same client id isn't taken for a duplicate
+	_, err = db.(*appdbimpl).c.Exec(`DROP TRIGGER fail_inbox`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := db.CreateThreadReply(alice, conversation_id, root_id, "text", "Me", nil, "reply-1")
+	if err != nil {
+		t.Fatalf("retry of the failed reply: %v", err)
+	}
+	if reply.ThreadRootId == nil || *reply.ThreadRootId != root_id {
+		t.Errorf("reply in thread %v, want %d", reply.ThreadRootId, root_id)
+	}
+	if count := countRows(t, db, "InboxItems"); count != 1 {
+		t.Errorf("%d inbox items, want the reply in the inbox of the root sender", count)
+	}
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/maisto1/WasaText/service/constants"
+	"github.com/maisto1/WasaText/service/globaltime"
+	"github.com/maisto1/WasaText/service/models"
+)
+
+// notExpiredCondition excludes the disappearing messages aliased as m which already expired. The current time is
+// inlined, so that no argument has to be added to the queries using it.
+func notExpiredCondition() string {
+	return `(m.expires_at IS NULL OR m.expires_at > ` + strconv.FormatInt(globaltime.Now().Unix(), 10) + `)`
+}
+
+// messageExpiry returns when a message sent now in the conversation disappears, or nil if the timer is off
+func (db *appdbimpl) messageExpiry(conversation_id int64, now int64) (*int64, error) {
+	var ttl int64
+
+	err := db.c.QueryRow(`SELECT message_ttl FROM Conversations WHERE conversation_id = ?`, conversation_id).Scan(&ttl)
+	if err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		return nil, nil
+	}
+
+	expires_at := now + ttl
+	return &expires_at, nil
+}
+
+// formatTTL writes a message timer in days past one day, otherwise in the largest unit dividing it, e.g. "24h" or "7d"
+func formatTTL(ttl int64) string {
+	switch {
+	case ttl > 86400 && ttl%86400 == 0:
+		return strconv.FormatInt(ttl/86400, 10) + "d"
+	case ttl%3600 == 0:
+		return strconv.FormatInt(ttl/3600, 10) + "h"
+	case ttl%60 == 0:
+		return strconv.FormatInt(ttl/60, 10) + "m"
+	default:
+		return strconv.FormatInt(ttl, 10) + "s"
+	}
+}
+
+func (db *appdbimpl) SetMessageTimer(user_id int64, conversation_id int64, ttl int64) (models.Message, error) {
+	var message models.Message
+
+	canManage, err := db.canManageConversation(user_id, conversation_id)
+	if err != nil {
+		return message, err
+	}
+	if !canManage {
+		return message, errors.New(constants.NotGroupAdmin)
+	}
+
+	user, err := db.GetUser(user_id)
+	if err != nil {
+		return message, err
+	}
+
+	content := user.Username + " turned off disappearing messages"
+	if ttl > 0 {
+		content = user.Username + " set disappearing messages to " + formatTTL(ttl)
+	}
+
+	now := globaltime.Now().Unix()
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return message, err
+	}
+
+	_, err = tx.Exec(`UPDATE Conversations SET message_ttl = ? WHERE conversation_id = ?`, ttl, conversation_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	// The notice itself never disappears, so that everyone can tell when the timer changed
+	var message_id int64
+	err = tx.QueryRow(`
+		INSERT INTO Messages (conversation_id, user_id, content, type, timestamp, status, isForwarded)
+		VALUES (?, ?, ?, 'system', ?, 'sent', 0) RETURNING message_id;`,
+		conversation_id, user_id, content, now).Scan(&message_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	err = createReceipts(tx, message_id, conversation_id, user_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return message, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return message, err
+	}
+
+	message.Message_id = message_id
+	message.Timestamp = now
+	message.Sender = user
+	message.Type = "system"
+	message.Content = content
+	message.Status = "sent"
+	message.Reactions = make([]models.ReactionSummary, 0)
+
+	return message, nil
+}
+
+func (db *appdbimpl) DeleteExpiredMessages(now int64) (int, error) {
+	rows, err := db.c.Query(`SELECT message_id FROM Messages WHERE expires_at <= ?`, now)
+	if err != nil {
+		return 0, err
+	}
+
+	var message_ids []int64
+	for rows.Next() {
+		var message_id int64
+		err = rows.Scan(&message_id)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		message_ids = append(message_ids, message_id)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return 0, rows.Err()
+	}
+
+	for i, message_id := range message_ids {
+		tx, err := db.c.Begin()
+		if err != nil {
+			return i, err
+		}
+
+		err = deleteMessage(tx, message_id)
+		if err != nil {
+			_ = tx.Rollback()
+			return i, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(message_ids), nil
+}
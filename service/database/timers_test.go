@@ -0,0 +1,68 @@
+package database
+
+import "testing"
+
+func TestSetMessageTimer(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, conversation_id := newTestConversation(t, db)
+	setTime(t, 1700000000)
+
+	notice, err := db.SetMessageTimer(alice, conversation_id, 60)
+	if err != nil {
+		t.Fatalf("SetMessageTimer: %v", err)
+	}
+	if notice.Content != "alice set disappearing messages to 1m" {
+		t.Errorf("notice %q", notice.Content)
+	}
+	if countRows(t, db, "Receipts") != 1 {
+		t.Errorf("the notice has no receipt for the other participant")
+	}
+
+	sendText(t, db, bob, conversation_id, "gone in a minute")
+
+	setTime(t, 1700000061)
+	messages, err := db.GetMessages(alice, conversation_id)
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	if len(messages) != 1 || messages[0].Message_id != notice.Message_id {
+		t.Errorf("got %d messages after the timer, want the notice only", len(messages))
+	}
+
+	deleted, err := db.DeleteExpiredMessages(1700000061)
+	if err != nil {
+		t.Fatalf("DeleteExpiredMessages: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("DeleteExpiredMessages deleted %d messages, want 1", deleted)
+	}
+}
+
+func TestSetMessageTimerStoresNothingOnFailure(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, _, conversation_id := newTestConversation(t, db)
+
+	_, err := db.(*appdbimpl).c.Exec(`
+		CREATE TRIGGER fail_receipt BEFORE INSERT ON Receipts
+		BEGIN SELECT RAISE(ABORT, 'receipt refused'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.SetMessageTimer(alice, conversation_id, 60)
+	if err == nil {
+		t.Fatal("SetMessageTimer succeeded although the receipts couldn't be stored")
+	}
+
+	if count := countRows(t, db, "Messages"); count != 0 {
+		t.Errorf("%d messages left by the failed timer", count)
+	}
+	var ttl int64
+	err = db.(*appdbimpl).c.QueryRow(`SELECT message_ttl FROM Conversations WHERE conversation_id = ?`, conversation_id).Scan(&ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl != 0 {
+		t.Errorf("the failed timer was set to %d", ttl)
+	}
+}
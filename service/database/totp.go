@@ -0,0 +1,119 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/maisto1/WasaText/service/globaltime"
+)
+
+func (db *appdbimpl) GetTotp(user_id int64) (string, bool, int64, error) {
+	var secret string
+	var enabled bool
+	var last_step int64
+
+	err := db.c.QueryRow("SELECT secret, enabled, last_step FROM TwoFactor WHERE user_id = ?;", user_id).Scan(&secret, &enabled, &last_step)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, 0, nil
+	}
+	if err != nil {
+		return "", false, 0, err
+	}
+
+	return secret, enabled, last_step, nil
+}
+
+func (db *appdbimpl) SetTotpSecret(user_id int64, secret string) error {
+	_, err := db.c.Exec(`
+		INSERT INTO TwoFactor (user_id, secret, enabled, last_step, created_at) VALUES (?, ?, 0, 0, ?)
+		ON CONFLICT(user_id) DO UPDATE SET secret = excluded.secret, created_at = excluded.created_at
+		WHERE TwoFactor.enabled = 0;`,
+		user_id, secret, globaltime.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) EnableTotp(user_id int64, step int64, recovery_hashes []string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE TwoFactor SET enabled = 1, last_step = ? WHERE user_id = ?;", step, user_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM RecoveryCodes WHERE user_id = ?;", user_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	for _, code_hash := range recovery_hashes {
+		_, err = tx.Exec("INSERT INTO RecoveryCodes (user_id, code_hash) VALUES (?, ?);", user_id, code_hash)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// The update is a compare-and-set, so that of two logins using the same code at the same time only one succeeds
+func (db *appdbimpl) SetTotpStep(user_id int64, step int64) (bool, error) {
+	res, err := db.c.Exec("UPDATE TwoFactor SET last_step = ? WHERE user_id = ? AND last_step < ?;", step, user_id, step)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func (db *appdbimpl) UseRecoveryCode(user_id int64, code_hash string) (bool, error) {
+	res, err := db.c.Exec(`
+		UPDATE RecoveryCodes SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL;`,
+		globaltime.Now().Unix(), user_id, code_hash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func (db *appdbimpl) DisableTotp(user_id int64) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM TwoFactor WHERE user_id = ?;", user_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM RecoveryCodes WHERE user_id = ?;", user_id)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
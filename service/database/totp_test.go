@@ -0,0 +1,70 @@
+package database
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSetTotpStepRefusesReplays(t *testing.T) {
+	db := newTestDatabase(t)
+
+	user_id, err := db.Login("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.SetTotpSecret(user_id, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.EnableTotp(user_id, 100, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		step int64
+		want bool
+	}{
+		{100, false}, // the code confirming the enrollment
+		{101, true},
+		{101, false},
+		{99, false},
+		{102, true},
+	} {
+		accepted, err := db.SetTotpStep(user_id, test.step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accepted != test.want {
+			t.Errorf("SetTotpStep(%d) = %v, want %v", test.step, accepted, test.want)
+		}
+	}
+
+	// Concurrent logins with the same code: only one is accepted
+	const logins = 8
+	var wg sync.WaitGroup
+	results := make(chan bool, logins)
+	for i := 0; i < logins; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			accepted, err := db.SetTotpStep(user_id, 103)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- accepted
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	count := 0
+	for accepted := range results {
+		if accepted {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("%d concurrent logins accepted the same code, want 1", count)
+	}
+}
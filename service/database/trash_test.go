@@ -0,0 +1,115 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/maisto1/WasaText/service/constants"
+)
+
+func TestRestoreMessage(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, conversation_id := newTestConversation(t, db)
+
+	setTime(t, 1700000000)
+	message_id := sendText(t, db, alice, conversation_id, "Don't lose me")
+
+	setTime(t, 1700000010)
+	err := db.DeleteMessage(alice, conversation_id, message_id)
+	if err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+
+	trash, err := db.GetTrash(alice, 1700000000)
+	if err != nil {
+		t.Fatalf("GetTrash: %v", err)
+	}
+	if len(trash) != 1 || trash[0].Message.Message_id != message_id || trash[0].Message.Content != "Don't lose me" {
+		t.Fatalf("trash %+v, want the deleted message with its content", trash)
+	}
+
+	err = db.RestoreMessage(bob, conversation_id, message_id, 1700000000)
+	if err == nil || err.Error() != constants.NotMessageSender {
+		t.Errorf("restore by another user: %v, want %s", err, constants.NotMessageSender)
+	}
+	err = db.RestoreMessage(alice, conversation_id, message_id, 1700000011)
+	if err == nil || err.Error() != constants.UndoWindowExpired {
+		t.Errorf("restore past the undo window: %v, want %s", err, constants.UndoWindowExpired)
+	}
+
+	err = db.RestoreMessage(alice, conversation_id, message_id, 1700000000)
+	if err != nil {
+		t.Fatalf("RestoreMessage: %v", err)
+	}
+	restored := findMessage(t, db, bob, conversation_id, message_id)
+	if restored == nil || restored.Deleted || restored.Content != "Don't lose me" {
+		t.Errorf("bob sees %+v, want the restored message", restored)
+	}
+	trash, err = db.GetTrash(alice, 1700000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 0 {
+		t.Errorf("%d messages left in the trash after the restore", len(trash))
+	}
+}
+
+func TestPurgeDeletedMessages(t *testing.T) {
+	db := newTestDatabase(t)
+	alice, bob, conversation_id := newTestConversation(t, db)
+
+	setTime(t, 1700000000)
+	purged_id := sendText(t, db, alice, conversation_id, "Gone for good")
+	kept_id := sendText(t, db, alice, conversation_id, "Still in the trash")
+	_, err := db.CreateComment(bob, conversation_id, purged_id, "Nice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.DeleteMessage(alice, conversation_id, purged_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setTime(t, 1700000100)
+	err = db.DeleteMessage(alice, conversation_id, kept_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := db.PurgeDeletedMessages(1700000050)
+	if err != nil {
+		t.Fatalf("PurgeDeletedMessages: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("PurgeDeletedMessages purged %d messages, want 1", purged)
+	}
+	var content string
+	err = db.(*appdbimpl).c.QueryRow(`SELECT COALESCE(content, '') FROM Messages WHERE message_id = ?`, purged_id).Scan(&content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "" {
+		t.Errorf("the purged message kept its content %q", content)
+	}
+	if count := countRows(t, db, "Comments"); count != 0 {
+		t.Errorf("%d comments left under the purged message", count)
+	}
+
+	trash, err := db.GetTrash(alice, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].Message.Message_id != kept_id {
+		t.Errorf("trash %+v, want the message deleted later only", trash)
+	}
+
+	err = db.RestoreMessage(alice, conversation_id, purged_id, 0)
+	if err == nil || err.Error() != constants.UndoWindowExpired {
+		t.Errorf("restore of a purged message: %v, want %s", err, constants.UndoWindowExpired)
+	}
+
+	// The tombstone stays in the conversation
+	tombstone := findMessage(t, db, bob, conversation_id, purged_id)
+	if tombstone == nil || !tombstone.Deleted {
+		t.Errorf("bob sees %+v, want the tombstone of the purged message", tombstone)
+	}
+}
@@ -12,8 +12,8 @@ func (db *appdbimpl) GetUsers(names string) []models.User {
 	name := strings.TrimSpace(names)
 
 	rows, err := db.c.Query(`
-        SELECT * FROM Users
-        WHERE username LIKE ?`,
+        SELECT user_id, username, profile_photo, kind = 'bot' FROM Users
+        WHERE username LIKE ? AND active = 1`,
 		"%"+name+"%",
 	)
 	if err != nil {
@@ -23,7 +23,7 @@ func (db *appdbimpl) GetUsers(names string) []models.User {
 
 	for rows.Next() {
 		var user models.User
-		err := rows.Scan(&user.User_id, &user.Username, &user.Photo)
+		err := rows.Scan(&user.User_id, &user.Username, &user.Photo, &user.IsBot)
 		if err != nil {
 			return users
 		}
@@ -36,6 +36,28 @@ func (db *appdbimpl) GetUsers(names string) []models.User {
 	return users
 }
 
+func (db *appdbimpl) GetUser(user_id int64) (models.User, error) {
+	var user models.User
+
+	err := db.c.QueryRow(`SELECT user_id, username, profile_photo, kind = 'bot' FROM Users WHERE user_id = ?`, user_id).Scan(&user.User_id, &user.Username, &user.Photo, &user.IsBot)
+	if err != nil {
+		return user, err
+	}
+
+	return user, nil
+}
+
+// userOrPlaceholder returns the user, or a placeholder if the account doesn't exist anymore
+func (db *appdbimpl) userOrPlaceholder(user_id int64) models.User {
+	user, err := db.GetUser(user_id)
+	if err != nil {
+		user.User_id = user_id
+		user.Username = "User"
+	}
+
+	return user
+}
+
 func (db *appdbimpl) EditProfileName(user_id int64, username string) error {
 	var count int
 	err := db.c.QueryRow(`
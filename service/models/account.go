@@ -0,0 +1,16 @@
+package models
+
+// Account holds the lifecycle attributes of a user, managed through the SCIM provisioning
+type Account struct {
+	User_id    int64
+	Username   string
+	ExternalId string
+	Active     bool
+}
+
+// AccountFilter selects accounts by a single attribute; empty fields are ignored
+type AccountFilter struct {
+	Username   string
+	ExternalId string
+	Active     *bool
+}
@@ -0,0 +1,10 @@
+package models
+
+type ApiKey struct {
+	Key_id     int64    `json:"id"`
+	Bot_id     int64    `json:"botId"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  int64    `json:"createdAt"`
+	LastUsedAt *int64   `json:"lastUsedAt"`
+}
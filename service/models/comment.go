@@ -6,4 +6,8 @@ type Comment struct {
 	Content    string `json:"content"`
 	Sender     User   `json:"sender"`
 	Timestamp  int64  `json:"timestamp"`
+	// ClientMessageId is the id given by the sender's client to recognise retries of the same comment
+	ClientMessageId string `json:"clientMessageId,omitempty"`
+	// Mentions are the participants named in the text of the comment, in order
+	Mentions []Mention `json:"mentions,omitempty"`
 }
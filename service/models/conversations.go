@@ -1,9 +1,13 @@
 package models
 
 type Preview struct {
-	Conversation_id  int64    `json:"id"`
-	Name             string   `json:"name"`
-	Photo            []byte   `json:"conversationPhoto"`
-	ConversationType string   `json:"conversationType"`
-	LatestMessage    *Message `json:"latestMessage"`
+	Conversation_id    int64    `json:"id"`
+	Name               string   `json:"name"`
+	Photo              []byte   `json:"conversationPhoto"`
+	ConversationType   string   `json:"conversationType"`
+	LatestMessage      *Message `json:"latestMessage"`
+	LastReadId         int64    `json:"lastReadId"`
+	UnreadCount        int      `json:"unreadCount"`
+	UnreadMentionCount int      `json:"unreadMentionCount"`
+	MessageTimer       int64    `json:"messageTimer"`
 }
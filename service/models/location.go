@@ -0,0 +1,30 @@
+package models
+
+// LocationDraft is a location to be sent as a message. Duration is how many seconds a live location is shared for, zero
+// for a location which doesn't move.
+type LocationDraft struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Accuracy  *float64 `json:"accuracy"`
+	Label     string   `json:"label"`
+	Duration  int64    `json:"duration"`
+}
+
+// Position is a point in degrees, with the radius of its uncertainty in meters when known
+type Position struct {
+	Latitude  float64
+	Longitude float64
+	Accuracy  *float64
+}
+
+// Location is the place of a message of type "location" or "live_location". A live location shows the last position
+// sent, at UpdatedAt, and is Live until LiveUntil, when its sharing ends or was stopped.
+type Location struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Accuracy  *float64 `json:"accuracy,omitempty"`
+	Label     string   `json:"label,omitempty"`
+	UpdatedAt int64    `json:"updatedAt"`
+	LiveUntil *int64   `json:"liveUntil,omitempty"`
+	Live      bool     `json:"live"`
+}
@@ -0,0 +1,29 @@
+package models
+
+// Mention is a @username in the text of a message or comment, naming a participant of its conversation. Offset and
+// Length count Unicode characters, the @ included.
+type Mention struct {
+	User   User `json:"user"`
+	Offset int  `json:"offset"`
+	Length int  `json:"length"`
+}
+
+// InboxItem tells the user about a message or comment mentioning them ("mention"), quoting one of their messages
+// ("reply") or replying in the thread of one of their messages ("thread")
+type InboxItem struct {
+	Item_id         int64    `json:"id"`
+	Kind            string   `json:"kind"`
+	Conversation_id int64    `json:"conversationId"`
+	Message         Message  `json:"message"`
+	Comment         *Comment `json:"comment,omitempty"`
+	Timestamp       int64    `json:"timestamp"`
+	Seen            bool     `json:"seen"`
+}
+
+// InboxPage is a page of the inbox of the user, the newest items first. OlderCursor is the item id to pass as
+// "before" to get the next page, null when there are no more items.
+type InboxPage struct {
+	Items       []InboxItem `json:"items"`
+	OlderCursor *int64      `json:"olderCursor"`
+	UnseenCount int         `json:"unseenCount"`
+}
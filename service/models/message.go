@@ -4,6 +4,7 @@ type ReplyInfo struct {
 	ID      int64  `json:"id"`
 	Content string `json:"content"`
 	Sender  string `json:"senderName"`
+	Deleted bool   `json:"deleted"`
 }
 
 type Message struct {
@@ -16,4 +17,66 @@ type Message struct {
 	Status     string     `json:"status"`
 	Forwarded  bool       `json:"isForwarded"`
 	ReplyTo    *ReplyInfo `json:"replyTo,omitempty"`
+	EditedAt   *int64     `json:"editedAt,omitempty"`
+	Deleted    bool       `json:"deleted"`
+	ExpiresAt  *int64     `json:"expiresAt,omitempty"`
+	// ClientMessageId is the id given by the sender's client to recognise retries of the same message
+	ClientMessageId string `json:"clientMessageId,omitempty"`
+	// Mentions are the participants named in the text of the message, in order
+	Mentions []Mention `json:"mentions,omitempty"`
+	// Reactions are the emojis used to react to the message, the most used first
+	Reactions []ReactionSummary `json:"reactions"`
+	// ThreadRootId is the message whose thread the message replies in, nil for messages in the timeline
+	ThreadRootId *int64 `json:"threadRootId,omitempty"`
+	// Thread summarises the replies in the thread of the message, nil if there are none
+	Thread *ThreadSummary `json:"thread,omitempty"`
+	// Poll is the poll of messages of type "poll", with its results
+	Poll *Poll `json:"poll,omitempty"`
+	// Location is the place of messages of type "location" and "live_location"
+	Location *Location `json:"location,omitempty"`
+}
+
+// TrashedMessage is a message deleted by its sender which can still be restored until ExpiresAt
+type TrashedMessage struct {
+	Conversation_id int64   `json:"conversationId"`
+	Message         Message `json:"message"`
+	DeletedAt       int64   `json:"deletedAt"`
+	ExpiresAt       int64   `json:"expiresAt"`
+}
+
+// PinnedMessage is a message pinned at the top of its conversation by PinnedBy
+type PinnedMessage struct {
+	Message  Message `json:"message"`
+	PinnedBy User    `json:"pinnedBy"`
+	PinnedAt int64   `json:"pinnedAt"`
+}
+
+// MessageEdit is a version of the text of a message, written at Timestamp
+type MessageEdit struct {
+	Content   string `json:"content"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// MessagePage is a slice of the history of a conversation. A cursor is null when there are no more messages in its
+// direction, otherwise it is the message id to pass as "before" (older) or "after" (newer) to get the next page.
+type MessagePage struct {
+	Messages    []Message `json:"messages"`
+	OlderCursor *int64    `json:"olderCursor"`
+	NewerCursor *int64    `json:"newerCursor"`
+}
+
+// ThreadSummary describes the replies in the thread of a message. Participants are the last few users who replied,
+// the latest first.
+type ThreadSummary struct {
+	ReplyCount   int    `json:"replyCount"`
+	LastReplyAt  int64  `json:"lastReplyAt"`
+	Participants []User `json:"participants"`
+}
+
+// Thread is a message with a page of the replies in its thread
+type Thread struct {
+	Root        Message   `json:"root"`
+	Replies     []Message `json:"replies"`
+	OlderCursor *int64    `json:"olderCursor"`
+	NewerCursor *int64    `json:"newerCursor"`
 }
@@ -0,0 +1,33 @@
+package models
+
+// PollDraft is a poll to be sent as a message, whose content is the question
+type PollDraft struct {
+	Question       string   `json:"question"`
+	Options        []string `json:"options"`
+	MultipleChoice bool     `json:"multipleChoice"`
+	Anonymous      bool     `json:"anonymous"`
+	ClosesAt       *int64   `json:"closesAt"`
+}
+
+// Poll is the poll of a message with its results, as seen by the user reading it. VoterCount counts every user who
+// voted, including those who left the conversation since.
+type Poll struct {
+	Question       string       `json:"question"`
+	Options        []PollOption `json:"options"`
+	MultipleChoice bool         `json:"multipleChoice"`
+	Anonymous      bool         `json:"anonymous"`
+	ClosesAt       *int64       `json:"closesAt,omitempty"`
+	Closed         bool         `json:"closed"`
+	ClosedAt       *int64       `json:"closedAt,omitempty"`
+	VoterCount     int          `json:"voterCount"`
+}
+
+// PollOption is an answer of a poll. Voted tells whether the user reading it chose it. Voters are the participants
+// who chose it, empty for anonymous polls: the votes of users who left the conversation are counted, not attributed.
+type PollOption struct {
+	Option_id int64  `json:"id"`
+	Text      string `json:"text"`
+	Votes     int    `json:"votes"`
+	Voted     bool   `json:"voted"`
+	Voters    []User `json:"voters,omitempty"`
+}
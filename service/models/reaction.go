@@ -0,0 +1,16 @@
+package models
+
+// Reaction is the emoji a user reacted to a message with
+type Reaction struct {
+	User      User   `json:"user"`
+	Emoji     string `json:"emoji"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// ReactionSummary counts the reactions to a message with Emoji. Reacted tells whether the user reading the message is
+// one of them.
+type ReactionSummary struct {
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+	Reacted bool   `json:"reacted"`
+}
@@ -0,0 +1,8 @@
+package models
+
+// Receipt tells when a recipient of a message received and read it
+type Receipt struct {
+	User        User   `json:"user"`
+	DeliveredAt *int64 `json:"deliveredAt"`
+	ReadAt      *int64 `json:"readAt"`
+}
@@ -0,0 +1,13 @@
+package models
+
+// ScheduledMessage is a message waiting to be sent by its sender at SendAt
+type ScheduledMessage struct {
+	Scheduled_id    int64  `json:"id"`
+	Conversation_id int64  `json:"conversationId"`
+	Sender_id       int64  `json:"-"`
+	Type            string `json:"type"`
+	Content         string `json:"content"`
+	Media           []byte `json:"media"`
+	SendAt          int64  `json:"sendAt"`
+	CreatedAt       int64  `json:"createdAt"`
+}
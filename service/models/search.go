@@ -0,0 +1,25 @@
+package models
+
+// SearchFilter narrows a full-text search. Zero values don't filter.
+type SearchFilter struct {
+	Text            string
+	Conversation_id int64
+	Sender          string
+	Type            string
+	From            int64
+	To              int64
+	Limit           int
+}
+
+// SearchHit is a message, or a comment under it, matching a search. ThreadRootId is set for replies in threads, to be
+// opened in their thread. Snippet is the HTML-escaped matching text with the matches wrapped in <mark> tags.
+type SearchHit struct {
+	Conversation_id int64  `json:"conversationId"`
+	Message_id      int64  `json:"messageId"`
+	Comment_id      *int64 `json:"commentId,omitempty"`
+	ThreadRootId    *int64 `json:"threadRootId,omitempty"`
+	Sender          User   `json:"sender"`
+	Type            string `json:"type"`
+	Snippet         string `json:"snippet"`
+	Timestamp       int64  `json:"timestamp"`
+}
@@ -0,0 +1,12 @@
+package models
+
+type Session struct {
+	Session_id int64  `json:"id"`
+	User_id    int64  `json:"userId"`
+	CreatedAt  int64  `json:"createdAt"`
+	LastUsedAt int64  `json:"lastUsedAt"`
+	ExpiresAt  int64  `json:"expiresAt"`
+	UserAgent  string `json:"userAgent"`
+	RemoteIP   string `json:"remoteIp"`
+	Current    bool   `json:"current"`
+}
@@ -0,0 +1,18 @@
+package models
+
+// StarredMessage is a message starred by the user, with the name and photo of its conversation as in its Preview
+type StarredMessage struct {
+	Star_id           int64   `json:"id"`
+	Conversation_id   int64   `json:"conversationId"`
+	ConversationName  string  `json:"conversationName"`
+	ConversationPhoto []byte  `json:"conversationPhoto"`
+	Message           Message `json:"message"`
+	StarredAt         int64   `json:"starredAt"`
+}
+
+// StarredPage is a page of the starred messages of the user, the last starred first. OlderCursor is the id to pass as
+// "before" to get the next page, null when there are no more messages.
+type StarredPage struct {
+	Messages    []StarredMessage `json:"messages"`
+	OlderCursor *int64           `json:"olderCursor"`
+}
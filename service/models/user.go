@@ -4,4 +4,5 @@ type User struct {
 	User_id  int64  `json:"id"`
 	Username string `json:"username"`
 	Photo    []byte `json:"profilePhoto"`
+	IsBot    bool   `json:"isBot"`
 }
@@ -0,0 +1,224 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/maisto1/WasaText/service/globaltime"
+)
+
+// clockSkew is the tolerance applied to the expiration and issue times of ID tokens.
+const clockSkew = 60
+
+// KeysRefreshInterval is the least time between two loads of the key set, so that tokens signed with unknown keys
+// can't make the provider be asked for its keys at every request.
+const KeysRefreshInterval = time.Minute
+
+// Claims are the claims of a verified ID token used by WasaText.
+type Claims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	Expiry            int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// audience is the "aud" claim, which can be either a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// Verify checks the signature and the claims of an ID token issued to WasaText for the login identified by nonce.
+func (p *Provider) Verify(ctx context.Context, rawToken string, nonce string) (Claims, error) {
+	var claims Claims
+
+	err := p.discover(ctx)
+	if err != nil {
+		return claims, err
+	}
+
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("id token: malformed")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err = decodeSegment(parts[0], &header)
+	if err != nil {
+		return claims, fmt.Errorf("id token header: %w", err)
+	}
+	if header.Alg != "RS256" {
+		return claims, fmt.Errorf("id token: unsupported algorithm %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, fmt.Errorf("id token signature: %w", err)
+	}
+
+	key, err := p.publicKey(ctx, header.Kid)
+	if err != nil {
+		return claims, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	if err != nil {
+		return claims, errors.New("id token: invalid signature")
+	}
+
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return claims, fmt.Errorf("id token claims: %w", err)
+	}
+
+	now := globaltime.Now().Unix()
+	switch {
+	case strings.TrimSuffix(claims.Issuer, "/") != p.cfg.Issuer:
+		return claims, errors.New("id token: wrong issuer")
+	case !claims.Audience.contains(p.cfg.ClientID):
+		return claims, errors.New("id token: wrong audience")
+	case claims.Expiry+clockSkew < now:
+		return claims, errors.New("id token: expired")
+	case claims.IssuedAt-clockSkew > now:
+		return claims, errors.New("id token: issued in the future")
+	case claims.Nonce != nonce:
+		return claims, errors.New("id token: wrong nonce")
+	case claims.Subject == "":
+		return claims, errors.New("id token: missing subject")
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// publicKey returns the signing key with the given id, reloading the key set if the key is unknown, to follow key
+// rotations at the provider. The set is reloaded at most once every KeysRefreshInterval, even if loading fails.
+func (p *Provider) publicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	key, loadedAt, ok := p.cachedKey(kid)
+	if ok {
+		return key, nil
+	}
+
+	// Requests missing the key wait for the one loading the set, then find the key in the cache
+	p.keysMu.Lock()
+	defer p.keysMu.Unlock()
+
+	key, loadedAt, ok = p.cachedKey(kid)
+	if ok {
+		return key, nil
+	}
+	now := globaltime.Now()
+	if !loadedAt.IsZero() && now.Sub(loadedAt) < KeysRefreshInterval {
+		return nil, fmt.Errorf("jwks: unknown key %q", kid)
+	}
+
+	p.mu.Lock()
+	p.keysLoadedAt = now
+	p.mu.Unlock()
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := p.getJSON(ctx, p.jwksURI, &set)
+	if err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		pub, err := parseRSAKey(k)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	key, ok = keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("jwks: unknown key %q", kid)
+	}
+	return key, nil
+}
+
+// cachedKey returns the signing key with the given id if it is in the key set, and when the set was last loaded.
+func (p *Provider) cachedKey(kid string) (*rsa.PublicKey, time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := p.keys[kid]
+	return key, p.keysLoadedAt, ok
+}
+
+func parseRSAKey(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
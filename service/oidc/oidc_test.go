@@ -0,0 +1,196 @@
+package oidc_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maisto1/WasaText/service/globaltime"
+	"github.com/maisto1/WasaText/service/oidc"
+	"github.com/maisto1/WasaText/service/oidc/oidctest"
+)
+
+// newTestProvider starts a mock identity provider and a Provider configured for it, both closed at the end of the test
+func newTestProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	idp, err := oidctest.NewServer("wasatext", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(idp.Close)
+
+	provider, err := oidc.New(oidc.Config{
+		Issuer:       idp.URL,
+		ClientID:     "wasatext",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/#/login/callback",
+		HTTPClient:   idp.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return idp, provider
+}
+
+// login runs the authorization code flow up to the code sent back by the provider
+func login(t *testing.T, idp *oidctest.Server, provider *oidc.Provider) (string, string, string) {
+	state, _ := oidc.NewState()
+	nonce, _ := oidc.NewState()
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, err := provider.AuthCodeURL(context.Background(), state, nonce, challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+
+	code, returnedState, err := idp.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if returnedState != state {
+		t.Fatalf("state %q sent back, want %q", returnedState, state)
+	}
+
+	return code, verifier, nonce
+}
+
+func TestExchange(t *testing.T) {
+	idp, provider := newTestProvider(t)
+	idp.Subject = "1234"
+	idp.PreferredUsername = "maria@example.com"
+
+	code, verifier, nonce := login(t, idp, provider)
+
+	claims, err := provider.Exchange(context.Background(), code, verifier, nonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Subject != "1234" || claims.PreferredUsername != "maria@example.com" {
+		t.Errorf("Exchange returned subject %q and username %q", claims.Subject, claims.PreferredUsername)
+	}
+
+	// A code is redeemed once only
+	_, err = provider.Exchange(context.Background(), code, verifier, nonce)
+	if err == nil {
+		t.Errorf("Exchange accepted a code already redeemed")
+	}
+}
+
+func TestExchangeRefusesWrongVerifierAndNonce(t *testing.T) {
+	idp, provider := newTestProvider(t)
+
+	code, _, nonce := login(t, idp, provider)
+	wrongVerifier, _, _ := oidc.NewPKCE()
+	_, err := provider.Exchange(context.Background(), code, wrongVerifier, nonce)
+	if err == nil {
+		t.Errorf("Exchange accepted a wrong PKCE verifier")
+	}
+
+	code, verifier, _ := login(t, idp, provider)
+	_, err = provider.Exchange(context.Background(), code, verifier, "another nonce")
+	if err == nil {
+		t.Errorf("Exchange accepted an ID token for another login")
+	}
+}
+
+func TestVerifyRefusesForgedTokens(t *testing.T) {
+	idp, provider := newTestProvider(t)
+
+	claims := idp.Claims("1234", "maria", "nonce")
+
+	claims["aud"] = "another client"
+	token, _ := idp.SignToken(idp.Kid(), claims)
+	if _, err := provider.Verify(context.Background(), token, "nonce"); err == nil {
+		t.Errorf("Verify accepted a token for another client")
+	}
+
+	claims = idp.Claims("1234", "maria", "nonce")
+	claims["iss"] = "https://evil.example.com"
+	token, _ = idp.SignToken(idp.Kid(), claims)
+	if _, err := provider.Verify(context.Background(), token, "nonce"); err == nil {
+		t.Errorf("Verify accepted a token of another issuer")
+	}
+
+	claims = idp.Claims("1234", "maria", "nonce")
+	claims["exp"] = globaltime.Now().Add(-time.Hour).Unix()
+	token, _ = idp.SignToken(idp.Kid(), claims)
+	if _, err := provider.Verify(context.Background(), token, "nonce"); err == nil {
+		t.Errorf("Verify accepted an expired token")
+	}
+
+	// The payload of a valid token changed without signing it again
+	token, _ = idp.SignToken(idp.Kid(), idp.Claims("1234", "maria", "nonce"))
+	other, _ := idp.SignToken(idp.Kid(), idp.Claims("5678", "maria", "nonce"))
+	tampered := token[:strings.Index(token, ".")] + other[strings.Index(other, "."):strings.LastIndex(other, ".")] +
+		token[strings.LastIndex(token, "."):]
+	if _, err := provider.Verify(context.Background(), tampered, "nonce"); err == nil {
+		t.Errorf("Verify accepted a token with a wrong signature")
+	}
+}
+
+func TestUnknownKeysReloadTheKeySetAtMostOncePerInterval(t *testing.T) {
+	idp, provider := newTestProvider(t)
+
+	globaltime.FixedTime = time.Unix(1700000000, 0)
+	t.Cleanup(func() { globaltime.FixedTime = time.Time{} })
+
+	token, _ := idp.SignToken(idp.Kid(), idp.Claims("1234", "maria", "nonce"))
+	if _, err := provider.Verify(context.Background(), token, "nonce"); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if idp.JWKSRequests() != 1 {
+		t.Fatalf("%d key set requests, want 1", idp.JWKSRequests())
+	}
+
+	// Tokens with unknown key ids don't reach the provider until the interval passes
+	for i := 0; i < 10; i++ {
+		forged, _ := idp.SignToken("forged", idp.Claims("1234", "maria", "nonce"))
+		if _, err := provider.Verify(context.Background(), forged, "nonce"); err == nil {
+			t.Fatalf("Verify accepted a token signed with an unknown key")
+		}
+	}
+	if idp.JWKSRequests() != 1 {
+		t.Errorf("%d key set requests after tokens with unknown keys, want 1", idp.JWKSRequests())
+	}
+
+	// After the interval, a rotated key is loaded
+	err := idp.RotateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	globaltime.FixedTime = globaltime.FixedTime.Add(oidc.KeysRefreshInterval)
+
+	token, _ = idp.SignToken(idp.Kid(), idp.Claims("1234", "maria", "nonce"))
+	if _, err := provider.Verify(context.Background(), token, "nonce"); err != nil {
+		t.Fatalf("Verify with a rotated key: %v", err)
+	}
+	if idp.JWKSRequests() != 2 {
+		t.Errorf("%d key set requests after the rotation, want 2", idp.JWKSRequests())
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp, provider := newTestProvider(t)
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme+"://"+u.Host+u.Path != idp.URL+"/authorize" {
+		t.Errorf("authorization URL %q doesn't point to the provider", authURL)
+	}
+	query := u.Query()
+	if query.Get("scope") != "openid profile" || query.Get("code_challenge_method") != "S256" {
+		t.Errorf("authorization URL %q misses the scope or the PKCE method", authURL)
+	}
+}
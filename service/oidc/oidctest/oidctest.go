@@ -0,0 +1,269 @@
+/*
+Package oidctest provides an OpenID Connect identity provider running in process, to test the login flow of the oidc
+package without a real provider.
+
+The provider serves the discovery document, the key set and the token endpoint over an httptest.Server. The login of
+the user at the provider is simulated by Authorize, which returns the authorization code the provider would send back
+to the redirect URL.
+*/
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/maisto1/WasaText/service/globaltime"
+)
+
+// Server is an identity provider serving a single client. Its URL is the issuer identifier.
+type Server struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+
+	// Subject and PreferredUsername identify the user logging in with the next Authorize
+	Subject           string
+	PreferredUsername string
+
+	mu           sync.Mutex
+	key          *rsa.PrivateKey
+	kid          string
+	keyCount     int
+	codes        map[string]authorization
+	jwksRequests int
+}
+
+// authorization is a code issued by Authorize, waiting to be redeemed at the token endpoint
+type authorization struct {
+	redirectURI       string
+	challenge         string
+	nonce             string
+	subject           string
+	preferredUsername string
+}
+
+// NewServer starts a provider for the client clientID, authenticated by clientSecret if not empty. It has to be closed
+// with Close.
+func NewServer(clientID string, clientSecret string) (*Server, error) {
+	s := &Server{
+		ClientID:          clientID,
+		ClientSecret:      clientSecret,
+		Subject:           "subject-1",
+		PreferredUsername: "maria",
+		codes:             make(map[string]authorization),
+	}
+
+	err := s.RotateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/jwks", s.jwks)
+	mux.HandleFunc("/token", s.token)
+	s.Server = httptest.NewServer(mux)
+
+	return s, nil
+}
+
+// RotateKey replaces the signing key with a new one, with a new key id. Tokens signed before can't be verified anymore.
+func (s *Server) RotateKey() error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keyCount++
+	s.key = key
+	s.kid = "key-" + strconv.Itoa(s.keyCount)
+	return nil
+}
+
+// JWKSRequests returns how many times the key set was requested.
+func (s *Server) JWKSRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.jwksRequests
+}
+
+// Authorize simulates the login of the user at authURL, the authorization URL built by the client. It returns the code
+// and the state the provider sends back to the redirect URL.
+func (s *Server) Authorize(authURL string) (string, string, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := u.Query()
+
+	switch {
+	case query.Get("response_type") != "code":
+		return "", "", errors.New("unsupported response type")
+	case query.Get("client_id") != s.ClientID:
+		return "", "", errors.New("unknown client")
+	case query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		return "", "", errors.New("missing PKCE challenge")
+	}
+
+	code, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+
+	s.mu.Lock()
+	s.codes[code] = authorization{
+		redirectURI:       query.Get("redirect_uri"),
+		challenge:         query.Get("code_challenge"),
+		nonce:             query.Get("nonce"),
+		subject:           s.Subject,
+		preferredUsername: s.PreferredUsername,
+	}
+	s.mu.Unlock()
+
+	return code, query.Get("state"), nil
+}
+
+// SignToken returns an ID token with the given claims, signed with the current key but with kid in its header.
+func (s *Server) SignToken(kid string, claims map[string]interface{}) (string, error) {
+	s.mu.Lock()
+	key := s.key
+	s.mu.Unlock()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Claims returns valid claims of an ID token for the client, issued now to subject for the login identified by nonce.
+func (s *Server) Claims(subject string, preferredUsername string, nonce string) map[string]interface{} {
+	now := globaltime.Now()
+	return map[string]interface{}{
+		"iss":                s.URL,
+		"sub":                subject,
+		"aud":                s.ClientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              nonce,
+		"preferred_username": preferredUsername,
+	}
+}
+
+// Kid returns the id of the current signing key.
+func (s *Server) Kid() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.kid
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.jwksRequests++
+	key := s.key.PublicKey
+	kid := s.kid
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+}
+
+// token redeems a code issued by Authorize, once, checking the client and the PKCE verifier
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if s.ClientSecret != "" {
+		// The client credentials are form encoded before being put in the header
+		id, secret, ok := r.BasicAuth()
+		id, errID := url.QueryUnescape(id)
+		secret, errSecret := url.QueryUnescape(secret)
+		if !ok || errID != nil || errSecret != nil || id != s.ClientID || secret != s.ClientSecret {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	code, ok := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	s.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("client_id") != s.ClientID || r.PostForm.Get("redirect_uri") != code.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	idToken, err := s.SignToken(s.Kid(), s.Claims(code.subject, code.preferredUsername, code.nonce))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomString() (string, error) {
+	buf := make([]byte, 24)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,70 @@
+package totp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/maisto1/WasaText/service/globaltime"
+)
+
+// rfcSecret is the SHA1 key of the test vectors of RFC 6238, "12345678901234567890", base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// setTime fixes the time seen by the package until the end of the test
+func setTime(t *testing.T, unix int64) {
+	globaltime.FixedTime = time.Unix(unix, 0)
+	t.Cleanup(func() { globaltime.FixedTime = time.Time{} })
+}
+
+func TestCodeRFC6238(t *testing.T) {
+	// The RFC lists 8 digits codes, these are their last 6 digits
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, vector := range vectors {
+		code, err := Code(rfcSecret, Step(time.Unix(vector.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", vector.unix, err)
+		}
+		if code != vector.code {
+			t.Errorf("Code at %d = %s, want %s", vector.unix, code, vector.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	setTime(t, 1234567890)
+	current := Step(globaltime.Now())
+
+	step, ok := Validate(rfcSecret, "005924", 0)
+	if !ok || step != current {
+		t.Fatalf("Validate of the current code = %d, %v, want %d, true", step, ok, current)
+	}
+
+	// Codes of the previous and next periods are accepted for clock drift, older ones are not
+	for _, offset := range []int64{-1, 1} {
+		code, _ := Code(rfcSecret, current+offset)
+		if step, ok := Validate(rfcSecret, code, 0); !ok || step != current+offset {
+			t.Errorf("Validate of the code of step %+d = %d, %v, want %d, true", offset, step, ok, current+offset)
+		}
+	}
+	code, _ := Code(rfcSecret, current-2)
+	if _, ok := Validate(rfcSecret, code, 0); ok {
+		t.Errorf("Validate accepted a code two periods old")
+	}
+
+	if _, ok := Validate(rfcSecret, "005924", current); ok {
+		t.Errorf("Validate accepted a code of the last accepted step")
+	}
+	if _, ok := Validate(rfcSecret, "000000", 0); ok {
+		t.Errorf("Validate accepted a wrong code")
+	}
+}